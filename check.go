@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+type checkIssue struct {
+	path string
+	line int
+	msg  string
+}
+
+func (x checkIssue) String() string {
+	if x.line > 0 {
+		return fmt.Sprintf("%s:%d: %s", x.path, x.line, x.msg)
+	}
+	return fmt.Sprintf("%s: %s", x.path, x.msg)
+}
+
+type configChecker struct {
+	ext    ExtIOFunc
+	issues []checkIssue
+}
+
+func (x *configChecker) report(path string, line int, format string, args ...interface{}) {
+	x.issues = append(x.issues, checkIssue{path: path, line: line, msg: fmt.Sprintf(format, args...)})
+}
+
+// tomlFieldNames returns toml tag names of struct fields.
+func tomlFieldNames(v interface{}) []string {
+	var names []string
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("toml")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var (
+	configFileKeys = tomlFieldNames(configFile{})
+	sectionKeys    = tomlFieldNames(altenvConfig{})
+	conditionKeys  = tomlFieldNames(sectionCondition{})
+)
+
+// checkConfigFiles validates config files that are loaded in the same way as
+// other run modes, and outputs found problems. It returns error if any
+// problem is found.
+func checkConfigFiles(params parameters, ext ExtIOFunc) error {
+	cwd, err := ext.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "Fail to get CWD")
+	}
+
+	checker := &configChecker{ext: ext}
+	loader := newConfigLoader(ext)
+	loader.checkTrust = false
+
+	if _, err := loader.load(xdgConfigPath(ext), false); err != nil {
+		checker.report(xdgConfigPath(ext), 0, "%v", err)
+	}
+	if found, err := loader.load(params.ConfigPath, false); err != nil {
+		checker.report(params.ConfigPath, 0, "%v", err)
+	} else if !found && params.ConfigPath != defaultConfigPath {
+		checker.report(params.ConfigPath, 0, "Config file is not found")
+	}
+	for _, path := range projectConfigPaths(cwd) {
+		if _, err := loader.load(path, true); err != nil {
+			checker.report(path, 0, "%v", err)
+		}
+	}
+
+	for _, file := range loader.files {
+		checker.checkFile(file)
+	}
+	checker.checkProfiles(loader.files)
+
+	w := ext.DryRunOutput
+	for _, issue := range checker.issues {
+		if _, err := fmt.Fprintln(w, issue); err != nil {
+			return errors.Wrap(err, "Fail to output check result")
+		}
+	}
+	if len(checker.issues) > 0 {
+		return fmt.Errorf("%d problem(s) found in config files", len(checker.issues))
+	}
+
+	if _, err := fmt.Fprintf(w, "No problem found in %d config file(s)\n", len(loader.files)); err != nil {
+		return errors.Wrap(err, "Fail to output check result")
+	}
+	return nil
+}
+
+func sortedSectionNames(sections map[string]altenvConfig) []string {
+	var names []string
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (x *configChecker) checkFile(file *configFile) {
+	tree, err := toml.LoadBytes(file.raw)
+	if err != nil {
+		x.report(file.path, 0, "Fail to parse toml: %v", err)
+		return
+	}
+	x.checkKeys(file.path, tree, nil, configFileKeys)
+
+	if file.project {
+		if db, err := loadTrustDB(x.ext); err != nil {
+			x.report(file.path, 0, "%v", err)
+		} else if err := db.verify(file.path, file.raw); err != nil {
+			x.report(file.path, 0, "%v", err)
+		}
+	}
+
+	line := func(keys ...string) int {
+		return tree.GetPositionPath(keys).Line
+	}
+
+	if tree.Has("global") {
+		x.checkSection(file, file.Global, line("global"))
+	}
+	for _, name := range sortedSectionNames(file.Workdirs) {
+		section := file.Workdirs[name]
+		x.checkSection(file, section, line("workdir", name))
+
+		if section.DirPath == "" {
+			x.report(file.path, line("workdir", name), "%s has no `dirpath` field", section.section)
+		} else if dirPath := expandConfigPath(section.DirPath, "", x.ext); !filepath.IsAbs(dirPath) {
+			x.report(file.path, line("workdir", name), "`dirpath` of %s is not absolute path and never matches: %s", section.section, section.DirPath)
+		}
+	}
+	for _, name := range sortedSectionNames(file.Profiles) {
+		x.checkSection(file, file.Profiles[name], line("profile", name))
+	}
+}
+
+// checkKeys reports unknown keys in tree. Sub tables of sections are checked
+// recursively.
+func (x *configChecker) checkKeys(path string, tree *toml.Tree, parents []string, allowed []string) {
+	keys := tree.Keys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := append(append([]string{}, parents...), key)
+		if !containsString(allowed, key) {
+			msg := fmt.Sprintf("unknown field `%s` in [%s]", key, strings.Join(parents, "."))
+			if len(parents) == 0 {
+				msg = fmt.Sprintf("unknown field `%s`", key)
+			}
+			if suggest := suggestKey(key, allowed); suggest != "" {
+				msg += fmt.Sprintf(", did you mean `%s`?", suggest)
+			}
+			x.report(path, tree.GetPositionPath([]string{key}).Line, "%s", msg)
+			continue
+		}
+
+		sub, ok := tree.GetPath([]string{key}).(*toml.Tree)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case len(parents) == 0 && key == "global":
+			x.checkKeys(path, sub, keyPath, sectionKeys)
+		case len(parents) == 0 && (key == "profile" || key == "workdir"):
+			names := sub.Keys()
+			sort.Strings(names)
+			for _, name := range names {
+				if section, ok := sub.GetPath([]string{name}).(*toml.Tree); ok {
+					x.checkKeys(path, section, append(keyPath, name), sectionKeys)
+				}
+			}
+		case key == "when":
+			x.checkKeys(path, sub, keyPath, conditionKeys)
+		}
+	}
+}
+
+func (x *configChecker) checkSection(file *configFile, section altenvConfig, line int) {
+	if section.Overwrite != nil {
+		if _, ok := overwritePolicyMap[*section.Overwrite]; !ok {
+			x.report(file.path, line, "`%s` is not valid overwrite option in %s, must be [deny|warn|allow]", *section.Overwrite, section.section)
+		}
+	}
+	if section.HostEnv != nil {
+		if _, ok := hostEnvPolicyMap[*section.HostEnv]; !ok {
+			x.report(file.path, line, "`%s` is not valid hostenv option in %s, must be [replace|keep|deny]", *section.HostEnv, section.section)
+		}
+	}
+	if section.Nested != nil {
+		if _, ok := nestedPolicyMap[*section.Nested]; !ok {
+			x.report(file.path, line, "`%s` is not valid nested option in %s, must be [warn|deny|allow]", *section.Nested, section.section)
+		}
+	}
+	if section.HookPolicy != nil {
+		if _, ok := hookPolicyMap[*section.HookPolicy]; !ok {
+			x.report(file.path, line, "`%s` is not valid hookPolicy option in %s, must be [abort|warn|ignore]", *section.HookPolicy, section.section)
+		}
+	}
+	if section.ArrayFormat != nil {
+		switch *section.ArrayFormat {
+		case arrayFormatDeny, arrayFormatJoin, arrayFormatJSON:
+		default:
+			x.report(file.path, line, "`%s` is not valid arrayFormat option in %s, must be [deny|join|json]", *section.ArrayFormat, section.section)
+		}
+	}
+
+	fileLists := []struct {
+		field   string
+		entries []string
+		query   bool // entry may have subtree query, e.g. `file.json#.path.to`
+	}{
+		{"envfile", section.EnvFiles, false},
+		{"jsonfile", section.JSONFiles, true},
+		{"yamlfile", section.YAMLFiles, true},
+		{"tomlfile", section.TOMLFiles, true},
+		{"k8sfile", section.K8sFiles, false},
+	}
+	for _, list := range fileLists {
+		x.checkDuplicates(file.path, line, list.field, section.section, list.entries)
+		for _, entry := range list.entries {
+			if list.query {
+				entry, _ = splitPathQuery(entry)
+			}
+			x.checkFileEntry(file.path, line, entry, section.section)
+		}
+	}
+
+	x.checkDuplicates(file.path, line, "compose", section.section, section.ComposeFiles)
+	for _, entry := range section.ComposeFiles {
+		path, optional := splitOptional(entry)
+		fpath, _, err := splitComposeEntry(path)
+		if err != nil {
+			x.report(file.path, line, "%v in %s", err, section.section)
+			continue
+		}
+		if optional {
+			fpath = "?" + fpath
+		}
+		x.checkFileEntry(file.path, line, fpath, section.section)
+	}
+
+	var keys []string
+	for _, def := range section.Defines {
+		v, err := parseDefine(def)
+		if err != nil {
+			x.report(file.path, line, "%v in define of %s", err, section.section)
+			continue
+		}
+		keys = append(keys, v.Key)
+	}
+	x.checkDuplicates(file.path, line, "define", section.section, keys)
+
+	keys = nil
+	for _, entry := range section.TempFiles {
+		key, _, err := parseTempFile(entry)
+		if err != nil {
+			x.report(file.path, line, "%v in file of %s", err, section.section)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	x.checkDuplicates(file.path, line, "file", section.section, keys)
+}
+
+// checkFileEntry reports a file entry that can not be read.
+func (x *configChecker) checkFileEntry(path string, line int, entry, section string) {
+	paths, err := expandFileEntries([]string{entry}, x.ext)
+	if err != nil {
+		x.report(path, line, "%v in %s", err, section)
+		return
+	}
+	for _, fpath := range paths {
+		if _, err := readAllFile(fpath, x.ext); err != nil {
+			x.report(path, line, "Fail to read %s in %s: %v", fpath, section, errors.Cause(err))
+		}
+	}
+}
+
+func (x *configChecker) checkDuplicates(path string, line int, field, section string, values []string) {
+	seen := map[string]bool{}
+	for _, v := range values {
+		if seen[v] {
+			x.report(path, line, "`%s` is defined more than once in %s of %s", v, field, section)
+		}
+		seen[v] = true
+	}
+}
+
+// checkProfiles reports profiles that can never be applied.
+func (x *configChecker) checkProfiles(files []*configFile) {
+	for _, file := range files {
+		for _, name := range sortedSectionNames(file.Profiles) {
+			if name != strings.TrimSpace(name) || strings.Contains(name, ",") || name == "" {
+				x.report(file.path, 0, "profile `%s` can not be specified by -p option", name)
+				continue
+			}
+			if _, _, err := resolveProfiles(files, []string{name}, nil); err != nil {
+				x.report(file.path, 0, "profile `%s` can never be applied: %v", name, err)
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestKey returns a similar key in candidates for typo.
+func suggestKey(key string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if strings.EqualFold(c, key) {
+			return c
+		}
+		if d := editDistance(strings.ToLower(key), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
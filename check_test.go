@@ -0,0 +1,106 @@
+package main_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runCheckTest(files map[string]string) (string, error) {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, files, "/somewhere", "HOME=/home/blue")
+	err := NewApp(params).Run([]string{"altenv", "-r", "check", "-c", "/conf/altenv.toml"})
+	return buf.String(), err
+}
+
+func TestCheckValidConfig(t *testing.T) {
+	out, err := runCheckTest(map[string]string{
+		"/conf/altenv.toml": `
+[global]
+envfile = ["common.env"]
+jsonfile = ["cfg.json#.dev", "?local.json#.dev"]
+overwrite = "warn"
+
+[workdir.proj]
+dirpath = "~/proj"
+
+[profile.base]
+define = ["COLOR=blue"]
+
+[profile.dev]
+extends = ["base"]
+
+[profile.dev.when]
+os = "linux"
+env = { CI = "true" }
+`,
+		"/conf/common.env": "MAGIC=5",
+		"/conf/cfg.json":   `{"dev": {"A": "1"}}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "No problem found in 1 config file(s)\n", out)
+}
+
+func TestCheckProblems(t *testing.T) {
+	out, err := runCheckTest(map[string]string{
+		"/conf/altenv.toml": `[global]
+envfiles = ["common.env"]
+keychainservicePrefix = "my."
+overwrite = "yes"
+
+[workdir.nodir]
+envfile = ["missing.env", "?optional.env"]
+
+[workdir.relative]
+dirpath = "works/proj"
+
+[profile.dup]
+define = ["COLOR=blue", "COLOR=red"]
+
+[profile.dup.when]
+branch = "main"
+
+[profile.orphan]
+extends = ["nothing"]
+
+[profile.loop1]
+extends = ["loop2"]
+
+[profile.loop2]
+extends = ["loop1"]
+`,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem(s) found in config files")
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Contains(t, lines, "/conf/altenv.toml:2: unknown field `envfiles` in [global], did you mean `envfile`?")
+	assert.Contains(t, lines, "/conf/altenv.toml:3: unknown field `keychainservicePrefix` in [global], did you mean `keychainServicePrefix`?")
+	assert.Contains(t, lines, "/conf/altenv.toml:1: `yes` is not valid overwrite option in [global] in /conf/altenv.toml, must be [deny|warn|allow]")
+	assert.Contains(t, lines, "/conf/altenv.toml:6: [workdir.nodir] in /conf/altenv.toml has no `dirpath` field")
+	assert.Contains(t, lines, "/conf/altenv.toml:6: Fail to read /conf/missing.env in [workdir.nodir] in /conf/altenv.toml: file does not exist")
+	assert.Contains(t, lines, "/conf/altenv.toml:9: `dirpath` of [workdir.relative] in /conf/altenv.toml is not absolute path and never matches: works/proj")
+	assert.Contains(t, lines, "/conf/altenv.toml:12: `COLOR` is defined more than once in define of [profile.dup] in /conf/altenv.toml")
+	assert.Contains(t, lines, "/conf/altenv.toml:16: unknown field `branch` in [profile.dup.when]")
+	assert.Contains(t, lines, "/conf/altenv.toml: profile `orphan` can never be applied: profile `nothing` extended by `orphan` is not found in config file")
+	assert.Contains(t, lines, "/conf/altenv.toml: profile `loop1` can never be applied: Circular extends of profile: loop1 -> loop2 -> loop1")
+	assert.Equal(t, 11, len(lines), out)
+}
+
+func TestCheckParseError(t *testing.T) {
+	out, err := runCheckTest(map[string]string{
+		"/conf/altenv.toml": "[global]\nenvfile = [\n",
+	})
+	require.Error(t, err)
+	assert.Contains(t, out, "/conf/altenv.toml: Fail to parse toml config file: /conf/altenv.toml")
+}
+
+func TestCheckConfigNotFound(t *testing.T) {
+	out, err := runCheckTest(map[string]string{})
+	require.Error(t, err)
+	assert.Equal(t, "/conf/altenv.toml: Config file is not found\n", out)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2"
@@ -26,20 +28,32 @@ func run(params parameters, args []string) error {
 		"args":   args,
 	}).Debug("Run altenv")
 
-	// Setup configuration
-	paramConfig := parametersToConfig(params)
-	masterConfig, err := loadConfigFile(params.ConfigPath, params.Profile, *params.ExtIO)
-	if err != nil {
-		return err
+	// Trust management and check of config files run without loading config
+	switch params.RunMode {
+	case "allow":
+		return allowConfigFiles(args, *params.ExtIO)
+	case "deny", "revoke":
+		return denyConfigFiles(args, *params.ExtIO)
+	case "check":
+		return checkConfigFiles(params, *params.ExtIO)
 	}
 
-	if masterConfig != nil {
-		masterConfig.merge(*paramConfig)
-	} else {
-		masterConfig = paramConfig
+	switch params.RunMode {
+	case "hook":
+		return printShellHook(params, args)
+	case "export":
+		return exportShellEnv(params, args)
+	case "diff":
+		return diffConfigs(params)
 	}
 
-	if err := masterConfig.finalize(); err != nil {
+	if params.Watch {
+		return watchCommand(params, args)
+	}
+
+	// Setup configuration
+	masterConfig, err := setupConfig(params, args, *params.ExtIO)
+	if err != nil {
 		return err
 	}
 
@@ -49,9 +63,34 @@ func run(params parameters, args []string) error {
 		return err
 	}
 
+	// Kubernetes manifest is not applied to the local environment
+	isManifest := params.OutputFormat == "k8s-secret" || params.OutputFormat == "k8s-configmap"
+	switch params.RunMode {
+	case "dryrun", "exec", "shell":
+		if params.RunMode == "dryrun" && isManifest {
+			break
+		}
+		envvars, err = applyHostEnv(envvars, params.ExtIO.environ(), masterConfig.hostEnv)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch params.RunMode {
+	case "dryrun", "exec", "shell":
+		profile, err := checkNestedProfile(params.Profile, params.ExtIO.environ(), masterConfig.nested)
+		if err != nil {
+			return err
+		}
+		// Markers are set only for interactive shell
+		if params.RunMode == "shell" {
+			envvars = addProfileMarkers(envvars, profile)
+		}
+	}
+
 	switch params.RunMode {
 	case "dryrun":
-		if err := dumpEnvVars(params.ExtIO.DryRunOutput, envvars); err != nil {
+		if err := dumpDryRun(params, *masterConfig, envvars); err != nil {
 			return err
 		}
 
@@ -71,7 +110,17 @@ func run(params parameters, args []string) error {
 		}
 
 	case "exec":
-		if err := execCommand(envvars, args); err != nil {
+		if err := execCommand(envvars, args, *masterConfig, *params.ExtIO); err != nil {
+			return err
+		}
+
+	case "plan":
+		if err := planCommand(envvars, args, *masterConfig, *params.ExtIO); err != nil {
+			return err
+		}
+
+	case "shell":
+		if err := execShell(envvars, args, *masterConfig, *params.ExtIO); err != nil {
 			return err
 		}
 
@@ -82,6 +131,57 @@ func run(params parameters, args []string) error {
 	return nil
 }
 
+// setupConfig loads config files and merges CLI options into them.
+func setupConfig(params parameters, args []string, ext ExtIOFunc) (*altenvConfig, error) {
+	paramConfig := parametersToConfig(params)
+	masterConfig, err := loadConfigFile(params.ConfigPath, params.Profile, args, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	if masterConfig != nil {
+		masterConfig.merge(*paramConfig)
+	} else {
+		masterConfig = paramConfig
+	}
+
+	if err := masterConfig.finalize(); err != nil {
+		return nil, err
+	}
+	if err := masterConfig.resolveDotenv(ext); err != nil {
+		return nil, err
+	}
+
+	return masterConfig, nil
+}
+
+func dumpDryRun(params parameters, config altenvConfig, envvars []*envvar) error {
+	k8sName := params.K8sName
+	if k8sName == "" {
+		k8sName = "altenv-" + strings.Replace(params.Profile, ",", "-", -1)
+	}
+
+	switch params.OutputFormat {
+	case "env", "":
+		var err error
+		if params.Provenance {
+			err = dumpEnvVarsWithProvenance(params.ExtIO.DryRunOutput, envvars, config)
+		} else {
+			err = dumpEnvVars(params.ExtIO.DryRunOutput, envvars)
+		}
+		if err != nil {
+			return err
+		}
+		return dumpTempFiles(params.ExtIO.DryRunOutput, config, envvars, params.ExtIO.environ())
+	case "k8s-secret":
+		return dumpK8sManifest(params.ExtIO.DryRunOutput, envvars, "Secret", k8sName, params.K8sNamespace)
+	case "k8s-configmap":
+		return dumpK8sManifest(params.ExtIO.DryRunOutput, envvars, "ConfigMap", k8sName, params.K8sNamespace)
+	default:
+		return fmt.Errorf("Invalid output format: `%s`", params.OutputFormat)
+	}
+}
+
 func newApp(params *parameters) *cli.App {
 	app := &cli.App{
 		Name:    "altenv",
@@ -108,9 +208,30 @@ func newApp(params *parameters) *cli.App {
 			&cli.StringSliceFlag{
 				Name:        "json",
 				Aliases:     []string{"j"},
-				Usage:       "Read from JSON file",
+				Usage:       "Read from JSON file, subtree can be selected by file.json#.path.to",
 				Destination: &params.JSONFiles,
 			},
+			&cli.StringSliceFlag{
+				Name:        "yaml",
+				Aliases:     []string{"y"},
+				Usage:       "Read from YAML file, subtree can be selected by file.yaml#.path.to",
+				Destination: &params.YAMLFiles,
+			},
+			&cli.StringSliceFlag{
+				Name:        "toml",
+				Usage:       "Read from TOML file, subtree can be selected by file.toml#.path.to",
+				Destination: &params.TOMLFiles,
+			},
+			&cli.StringSliceFlag{
+				Name:        "k8s",
+				Usage:       "Read from Secret and ConfigMap in Kubernetes manifest file",
+				Destination: &params.K8sFiles,
+			},
+			&cli.StringSliceFlag{
+				Name:        "compose",
+				Usage:       "Read environment of a service in docker-compose file, e.g. docker-compose.yml:api",
+				Destination: &params.ComposeFiles,
+			},
 			&cli.StringSliceFlag{
 				Name:        "define",
 				Aliases:     []string{"d"},
@@ -131,7 +252,7 @@ func newApp(params *parameters) *cli.App {
 			&cli.StringFlag{
 				Name:        "input",
 				Aliases:     []string{"i"},
-				Usage:       "Specify stdin format [env|json]",
+				Usage:       "Specify stdin format [env|json|yaml|toml|aws-assume-role]",
 				Destination: &params.Stdin,
 			},
 
@@ -145,7 +266,7 @@ func newApp(params *parameters) *cli.App {
 			&cli.StringFlag{
 				Name:        "config",
 				Aliases:     []string{"c"},
-				Usage:       "Config file",
+				Usage:       "User config file, layered with XDG config and project .altenv.toml files",
 				Destination: &params.ConfigPath,
 				Value:       defaultConfigPath,
 			},
@@ -154,15 +275,53 @@ func newApp(params *parameters) *cli.App {
 			&cli.StringFlag{
 				Name:        "run-mode",
 				Aliases:     []string{"r"},
-				Usage:       "Run mode [exec|dryrun|update-keychain]",
+				Usage:       "Run mode [exec|dryrun|plan|shell|diff|update-keychain|allow|deny|check|hook|export]",
 				Value:       "exec",
 				Destination: &params.RunMode,
 			},
+			&cli.StringFlag{
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Usage:       "Output format of dryrun [env|k8s-secret|k8s-configmap] and diff [env|json]",
+				Value:       "env",
+				Destination: &params.OutputFormat,
+			},
+			&cli.BoolFlag{
+				Name:        "provenance",
+				Usage:       "Show loaded config files and source of each variable in dryrun",
+				Destination: &params.Provenance,
+			},
+			&cli.StringFlag{
+				Name:        "k8s-name",
+				Usage:       "Resource name of Kubernetes manifest output (default: altenv-<profile>)",
+				Destination: &params.K8sName,
+			},
+			&cli.StringFlag{
+				Name:        "k8s-namespace",
+				Usage:       "Namespace of Kubernetes manifest output",
+				Destination: &params.K8sNamespace,
+			},
+
+			&cli.StringFlag{
+				Name:        "diff-profile",
+				Usage:       "Profile to be compared in diff mode",
+				Destination: &params.DiffProfile,
+			},
+			&cli.StringFlag{
+				Name:        "diff-dir",
+				Usage:       "Working directory to be compared in diff mode",
+				Destination: &params.DiffDir,
+			},
+			&cli.StringFlag{
+				Name:        "diff-config",
+				Usage:       "Config file to be compared in diff mode",
+				Destination: &params.DiffConfig,
+			},
 
 			&cli.StringFlag{
 				Name:        "profile",
 				Aliases:     []string{"p"},
-				Usage:       "Use profile",
+				Usage:       "Use profile, multiple profiles can be stacked by a,b",
 				Destination: &params.Profile,
 				Value:       defaultProfileName,
 			},
@@ -173,6 +332,90 @@ func newApp(params *parameters) *cli.App {
 				Destination: &params.Overwrite,
 			},
 
+			&cli.StringFlag{
+				Name:        "hostenv",
+				Usage:       "Policy for variables already set in parent environment [replace|keep|deny] (default: replace)",
+				Destination: &params.HostEnv,
+			},
+
+			&cli.StringFlag{
+				Name:        "dotenv",
+				Usage:       "Load .env, .env.local, .env.<ENV> and .env.<ENV>.local in CWD for the environment",
+				Destination: &params.Dotenv,
+			},
+
+			&cli.StringFlag{
+				Name:        "nested",
+				Usage:       "Policy when a profile is already activated by altenv (ALTENV_PROFILE) [warn|deny|allow] (default: warn)",
+				Destination: &params.Nested,
+			},
+
+			&cli.BoolFlag{
+				Name:        "supervise",
+				Usage:       "Run command as child process instead of replacing altenv process in exec and shell mode",
+				Destination: &params.Supervise,
+			},
+			&cli.BoolFlag{
+				Name:        "redact",
+				Usage:       "Replace secret values in stdout and stderr of command with ***, supervise mode is enabled",
+				Destination: &params.Redact,
+			},
+			&cli.BoolFlag{
+				Name:        "watch",
+				Usage:       "Restart command when files read to load variables are changed, only in exec mode",
+				Destination: &params.Watch,
+			},
+			&cli.DurationFlag{
+				Name:        "watch-interval",
+				Usage:       "Interval to check changes of files in watch mode",
+				Value:       time.Second,
+				Destination: &params.WatchInterval,
+			},
+			&cli.StringFlag{
+				Name:        "stop-signal",
+				Usage:       "Signal to stop command on restart in watch mode [TERM|INT|HUP|QUIT|KILL|USR1|USR2]",
+				Value:       "TERM",
+				Destination: &params.StopSignal,
+			},
+			&cli.DurationFlag{
+				Name:        "stop-timeout",
+				Usage:       "Timeout to kill command after stop signal in watch mode",
+				Value:       10 * time.Second,
+				Destination: &params.StopTimeout,
+			},
+			&cli.BoolFlag{
+				Name:        "template",
+				Aliases:     []string{"t"},
+				Usage:       "Render variable values as Go text/template after loading all sources",
+				Destination: &params.Template,
+			},
+
+			&cli.BoolFlag{
+				Name:        "coerce",
+				Usage:       "Convert number, bool and null in structured file (JSON, YAML and TOML) to string",
+				Destination: &params.Coerce,
+			},
+			&cli.BoolFlag{
+				Name:        "flatten",
+				Usage:       "Flatten nested object in structured file (JSON, YAML and TOML) into PARENT_CHILD key",
+				Destination: &params.Flatten,
+			},
+			&cli.StringFlag{
+				Name:        "flatten-separator",
+				Usage:       "Separator of flattened key (default: _)",
+				Destination: &params.FlattenSeparator,
+			},
+			&cli.StringFlag{
+				Name:        "array-format",
+				Usage:       "Format of array in structured file (JSON, YAML and TOML) [deny|join|json] (default: deny)",
+				Destination: &params.ArrayFormat,
+			},
+			&cli.StringFlag{
+				Name:        "array-separator",
+				Usage:       "Separator of joined array (default: ,)",
+				Destination: &params.ArraySeparator,
+			},
+
 			&cli.StringFlag{
 				Name:        "keychain-service-prefix",
 				Usage:       "Specify keychain service name prefix (default: altenv.)",
@@ -195,6 +438,9 @@ func main() {
 	app := newApp(&params)
 
 	err := app.Run(os.Args)
+	if _, ok := exitStatus(err); ok {
+		exitBySignal(err)
+	}
 	if err != nil {
 		logger.WithError(err).Fatal("altenv failed")
 	}
@@ -504,3 +504,57 @@ define = ["WORDS=TIMELESS"]
 	assert.NotContains(t, envmap, "WORDS")
 	assert.NotContains(t, envmap, "NOT")
 }
+
+func newHostEnvTestApp(buf *bytes.Buffer) *cli.App {
+	params := &Parameters{
+		ExtIO: &ExtIOFunc{
+			Getwd:        dummyGetwd,
+			DryRunOutput: buf,
+			OpenFunc:     fileNeverExists,
+			Environ: func() []string {
+				return []string{"COLOR=RED", "HOME=/home/blue"}
+			},
+		},
+	}
+	return NewApp(params)
+}
+
+func TestHostEnvDefaultReplace(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := newHostEnvTestApp(buf)
+
+	err := app.Run(newArgs("-l", "error", "-d", "COLOR=BLUE", "-d", "MAGIC=5"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "BLUE", envmap["COLOR"])
+	assert.Equal(t, "5", envmap["MAGIC"])
+}
+
+func TestHostEnvKeep(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := newHostEnvTestApp(buf)
+
+	err := app.Run(newArgs("-l", "error", "--hostenv", "keep", "-d", "COLOR=BLUE", "-d", "MAGIC=5"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.NotContains(t, envmap, "COLOR")
+	assert.Equal(t, "5", envmap["MAGIC"])
+}
+
+func TestHostEnvDeny(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := newHostEnvTestApp(buf)
+
+	err := app.Run(newArgs("--hostenv", "deny", "-d", "COLOR=BLUE"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Deny to overwrite inherited environment variable")
+}
+
+func TestHostEnvInvalidPolicy(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := newHostEnvTestApp(buf)
+
+	err := app.Run(newArgs("--hostenv", "xxx", "-d", "COLOR=BLUE"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not valid hostenv option")
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Environment composeEnvironment `yaml:"environment"`
+	EnvFile     composeEnvFiles    `yaml:"env_file"`
+}
+
+// composeEnvironment is `environment` of service. Both of map and list
+// forms are acceptable. Value is nil if only key is given.
+type composeEnvironment []composeEnvItem
+
+type composeEnvItem struct {
+	Key   string
+	Value *string
+}
+
+func (x *composeEnvironment) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		for _, item := range list {
+			if pos := strings.Index(item, "="); pos >= 0 {
+				value := item[pos+1:]
+				*x = append(*x, composeEnvItem{Key: item[:pos], Value: &value})
+			} else {
+				*x = append(*x, composeEnvItem{Key: item})
+			}
+		}
+		return nil
+	}
+
+	var dict yaml.MapSlice
+	if err := unmarshal(&dict); err != nil {
+		return errors.Wrap(err, "environment must be map or list")
+	}
+	for _, item := range dict {
+		envItem := composeEnvItem{Key: fmt.Sprint(item.Key)}
+		if item.Value != nil {
+			value := fmt.Sprint(item.Value)
+			envItem.Value = &value
+		}
+		*x = append(*x, envItem)
+	}
+	return nil
+}
+
+// composeEnvFiles is `env_file` of service. String, list of string and
+// list of {path, required} are acceptable.
+type composeEnvFiles []composeEnvFile
+
+type composeEnvFile struct {
+	Path     string `yaml:"path"`
+	Required *bool  `yaml:"required"`
+}
+
+func (x *composeEnvFiles) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*x = composeEnvFiles{{Path: single}}
+		return nil
+	}
+
+	var items []interface{}
+	if err := unmarshal(&items); err != nil {
+		return errors.Wrap(err, "env_file must be string or list")
+	}
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			*x = append(*x, composeEnvFile{Path: v})
+		case map[interface{}]interface{}:
+			envFile := composeEnvFile{Path: fmt.Sprint(v["path"])}
+			if required, ok := v["required"].(bool); ok {
+				envFile.Required = &required
+			}
+			*x = append(*x, envFile)
+		default:
+			return fmt.Errorf("Invalid env_file item: %v", item)
+		}
+	}
+	return nil
+}
+
+// splitComposeEntry splits `docker-compose.yml:service` into path and service.
+func splitComposeEntry(entry string) (string, string, error) {
+	pos := strings.LastIndex(entry, ":")
+	if pos < 0 || pos == len(entry)-1 {
+		return "", "", fmt.Errorf("Service name is required in compose option, e.g. docker-compose.yml:api: `%s`", entry)
+	}
+	return entry[:pos], entry[pos+1:], nil
+}
+
+func readComposeFile(entry string, ext ExtIOFunc) ([]*envvar, error) {
+	fpath, service, err := splitComposeEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := readAllFile(fpath, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	var compose composeFile
+	if err := yaml.Unmarshal(raw, &compose); err != nil {
+		return nil, errors.Wrapf(err, "Fail to parse compose file %s", fpath)
+	}
+
+	svc, ok := compose.Services[service]
+	if !ok {
+		return nil, fmt.Errorf("Service `%s` is not found in %s", service, fpath)
+	}
+
+	baseDir := filepath.Dir(fpath)
+	lookup, err := newComposeLookup(filepath.Join(baseDir, ".env"), ext)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveComposeService(svc, baseDir, lookup, ext)
+}
+
+type composeLookup func(key string) (string, bool)
+
+// newComposeLookup creates variable lookup function for interpolation.
+// Inherited environment variables take priority over project .env file.
+func newComposeLookup(dotenvPath string, ext ExtIOFunc) (composeLookup, error) {
+	hostenv := splitEnviron(ext.environ())
+	dotenv := map[string]string{}
+
+	vars, err := readDotenvFile(dotenvPath, ext)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, errors.Wrapf(err, "Fail to read %s", dotenvPath)
+	}
+	for _, v := range vars {
+		dotenv[v.Key] = v.Value
+	}
+
+	return func(key string) (string, bool) {
+		if v, ok := hostenv[key]; ok {
+			return v, true
+		}
+		v, ok := dotenv[key]
+		return v, ok
+	}, nil
+}
+
+func resolveComposeService(svc composeService, baseDir string, lookup composeLookup, ext ExtIOFunc) ([]*envvar, error) {
+	values := map[string]string{}
+	var keys []string
+	set := func(key, value string) {
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+
+	for _, envFile := range svc.EnvFile {
+		fpath, err := interpolateCompose(envFile.Path, lookup)
+		if err != nil {
+			return nil, err
+		}
+		fpath = expandPath(fpath, baseDir, ext)
+
+		vars, err := readDotenvFile(fpath, ext)
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) && envFile.Required != nil && !*envFile.Required {
+				logger.WithField("path", fpath).Debug("Skip optional env_file")
+				continue
+			}
+			return nil, errors.Wrapf(err, "Fail to read env_file %s", fpath)
+		}
+
+		for _, v := range vars {
+			value, err := interpolateCompose(v.Value, lookup)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Fail to interpolate `%s` in %s", v.Key, fpath)
+			}
+			set(v.Key, value)
+		}
+	}
+
+	for _, item := range svc.Environment {
+		if item.Value == nil {
+			// Only key is given, the value comes from environment
+			if value, ok := lookup(item.Key); ok {
+				set(item.Key, value)
+			}
+			continue
+		}
+
+		value, err := interpolateCompose(*item.Value, lookup)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Fail to interpolate `%s`", item.Key)
+		}
+		set(item.Key, value)
+	}
+
+	var envvars []*envvar
+	for _, key := range keys {
+		envvars = append(envvars, &envvar{Key: key, Value: values[key]})
+
+		logger.WithFields(logrus.Fields{
+			"type":  "compose",
+			"key":   key,
+			"value": values[key],
+		}).Debug("Add a new variable")
+	}
+
+	return envvars, nil
+}
+
+func isComposeNameChar(c byte, first bool) bool {
+	if c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+		return true
+	}
+	return !first && '0' <= c && c <= '9'
+}
+
+// interpolateCompose replaces `$VAR` and `${VAR}` style variables according
+// to docker-compose rules. `:-`, `-`, `:?`, `?`, `:+` and `+` modifiers are
+// supported and `$$` is escape of `$`.
+func interpolateCompose(s string, lookup composeLookup) (string, error) {
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			buf.WriteByte('$')
+			i++
+
+		case next == '{':
+			end, depth := -1, 0
+			for j := i + 1; j < len(s); j++ {
+				if s[j] == '{' {
+					depth++
+				} else if s[j] == '}' {
+					depth--
+					if depth == 0 {
+						end = j
+						break
+					}
+				}
+			}
+			if end < 0 {
+				return "", fmt.Errorf("Invalid interpolation format, missing `}`: %s", s)
+			}
+
+			value, err := interpolateComposeBraced(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(value)
+			i = end
+
+		case isComposeNameChar(next, true):
+			j := i + 1
+			for j < len(s) && isComposeNameChar(s[j], false) {
+				j++
+			}
+			value, _ := lookup(s[i+1 : j])
+			buf.WriteString(value)
+			i = j - 1
+
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+
+	return buf.String(), nil
+}
+
+func interpolateComposeBraced(expr string, lookup composeLookup) (string, error) {
+	n := 0
+	for n < len(expr) && isComposeNameChar(expr[n], n == 0) {
+		n++
+	}
+	if n == 0 {
+		return "", fmt.Errorf("Invalid interpolation format: ${%s}", expr)
+	}
+
+	name, rest := expr[:n], expr[n:]
+	value, ok := lookup(name)
+	if rest == "" {
+		return value, nil
+	}
+
+	colon := strings.HasPrefix(rest, ":")
+	if colon {
+		rest = rest[1:]
+	}
+	if rest == "" {
+		return "", fmt.Errorf("Invalid interpolation format: ${%s}", expr)
+	}
+
+	// With colon, empty value is treated as unset
+	set := ok && !(colon && value == "")
+	arg, err := interpolateCompose(rest[1:], lookup)
+	if err != nil {
+		return "", err
+	}
+
+	switch rest[0] {
+	case '-':
+		if set {
+			return value, nil
+		}
+		return arg, nil
+	case '+':
+		if set {
+			return arg, nil
+		}
+		return "", nil
+	case '?':
+		if set {
+			return value, nil
+		}
+		return "", fmt.Errorf("Required variable `%s` is missing a value: %s", name, arg)
+	default:
+		return "", fmt.Errorf("Invalid interpolation format: ${%s}", expr)
+	}
+}
@@ -0,0 +1,90 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newComposeTestParams(buf *bytes.Buffer) *Parameters {
+	compose := `
+version: "3"
+services:
+  api:
+    image: my-api
+    env_file:
+      - api.env
+      - path: ./local.env
+        required: false
+    environment:
+      DB_HOST: ${DB_HOST:-localhost}
+      DB_NAME: ${PROJECT}_db
+      PRICE: $$100
+      HOME_DIR:
+  worker:
+    environment:
+      - QUEUE=${QUEUE:?queue is required}
+      - REGION
+      - COLOR=${COLOR-blue}
+`
+	files := map[string]string{
+		"/proj/docker-compose.yml": compose,
+		"/proj/.env":               "PROJECT=\"myproj\"\nREGION=ap-northeast-1",
+		"/proj/api.env":            "DB_NAME=overwritten\nDB_PORT=5432\nLOG_DIR=/var/log/${PROJECT}",
+	}
+	return newTestParams(buf, files, "/some/where", "HOME_DIR=/home/blue", "COLOR=")
+}
+
+func TestComposeServiceEnvironmentMap(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newComposeTestParams(buf))
+
+	err := app.Run(newArgs("-l", "error", "--compose", "/proj/docker-compose.yml:api"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "localhost", envmap["DB_HOST"])
+	assert.Equal(t, "myproj_db", envmap["DB_NAME"])
+	assert.Equal(t, "5432", envmap["DB_PORT"])
+	assert.Equal(t, "/var/log/myproj", envmap["LOG_DIR"])
+	assert.Equal(t, "$100", envmap["PRICE"])
+	assert.Equal(t, "/home/blue", envmap["HOME_DIR"])
+}
+
+func TestComposeServiceEnvironmentListRequiredMissing(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newComposeTestParams(buf))
+
+	err := app.Run(newArgs("--compose", "/proj/docker-compose.yml:worker"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "queue is required")
+}
+
+func TestComposeServiceEnvironmentList(t *testing.T) {
+	buf := &bytes.Buffer{}
+	params := newComposeTestParams(buf)
+	params.ExtIO.Environ = func() []string { return []string{"QUEUE=jobs", "COLOR="} }
+	app := NewApp(params)
+
+	err := app.Run(newArgs("-l", "error", "--compose", "/proj/docker-compose.yml:worker"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "jobs", envmap["QUEUE"])
+	assert.Equal(t, "ap-northeast-1", envmap["REGION"])
+	assert.Equal(t, "", envmap["COLOR"])
+}
+
+func TestComposeServiceNotFound(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newComposeTestParams(buf))
+
+	err := app.Run(newArgs("--compose", "/proj/docker-compose.yml:db"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Service `db` is not found")
+
+	err = NewApp(newComposeTestParams(buf)).Run(newArgs("--compose", "/proj/docker-compose.yml"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Service name is required")
+}
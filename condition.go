@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sectionCondition is `when` table of config section. The section is
+// applied only if all of specified conditions are matched. Patterns are
+// glob style and `*` matches any characters including `/`.
+type sectionCondition struct {
+	OS         string            `toml:"os"`
+	Hostname   string            `toml:"hostname"`
+	GitBranch  string            `toml:"gitBranch"`
+	GitRemote  string            `toml:"gitRemote"`
+	FileExists string            `toml:"fileExists"`
+	Env        map[string]string `toml:"env"`
+	Command    string            `toml:"command"`
+}
+
+// conditionContext has current state to be compared with conditions. Git
+// repository information is read once when it's required.
+type conditionContext struct {
+	cwd  string
+	args []string
+	ext  ExtIOFunc
+
+	gitLoaded  bool
+	gitBranch  string
+	gitRemotes []string
+}
+
+// matchPattern matches s with glob style pattern. `*` matches any
+// characters and `?` matches one character.
+func matchPattern(pattern, s string) bool {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String()).MatchString(s)
+}
+
+// matchCondition returns true if cond is nil or all conditions are matched.
+func matchCondition(cond *sectionCondition, ctx *conditionContext) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+
+	if cond.OS != "" && !matchPattern(cond.OS, runtime.GOOS) {
+		return false, nil
+	}
+
+	if cond.Hostname != "" {
+		hostname, err := ctx.ext.hostname()
+		if err != nil {
+			return false, errors.Wrap(err, "Fail to get hostname")
+		}
+		if !matchPattern(cond.Hostname, hostname) {
+			return false, nil
+		}
+	}
+
+	if cond.GitBranch != "" || cond.GitRemote != "" {
+		if err := ctx.loadGit(); err != nil {
+			return false, err
+		}
+		if cond.GitBranch != "" && (ctx.gitBranch == "" || !matchPattern(cond.GitBranch, ctx.gitBranch)) {
+			return false, nil
+		}
+		if cond.GitRemote != "" {
+			matched := false
+			for _, remote := range ctx.gitRemotes {
+				if matchPattern(cond.GitRemote, remote) {
+					matched = true
+				}
+			}
+			if !matched {
+				return false, nil
+			}
+		}
+	}
+
+	if cond.FileExists != "" {
+		fd, err := ctx.ext.OpenFunc(expandConfigPath(cond.FileExists, ctx.cwd, ctx.ext))
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, errors.Wrapf(err, "Fail to check file %s", cond.FileExists)
+		}
+		fd.Close()
+	}
+
+	for key, pattern := range cond.Env {
+		value, ok := ctx.ext.lookupEnv(key)
+		if !ok || !matchPattern(pattern, value) {
+			return false, nil
+		}
+	}
+
+	if cond.Command != "" {
+		if len(ctx.args) == 0 || !matchPattern(cond.Command, filepath.Base(ctx.args[0])) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// loadGit reads current branch and remote URLs of git repository that
+// contains CWD. Nothing is set if CWD is not in git repository.
+func (x *conditionContext) loadGit() error {
+	if x.gitLoaded {
+		return nil
+	}
+	x.gitLoaded = true
+
+	gitDir, commonDir, err := findGitDir(x.cwd, x.ext)
+	if err != nil || gitDir == "" {
+		return err
+	}
+
+	head, err := readAllFile(filepath.Join(gitDir, "HEAD"), x.ext)
+	if err != nil {
+		return errors.Wrapf(err, "Fail to read HEAD of git repository %s", gitDir)
+	}
+	if ref := strings.TrimSpace(string(head)); strings.HasPrefix(ref, "ref: refs/heads/") {
+		x.gitBranch = strings.TrimPrefix(ref, "ref: refs/heads/")
+	}
+
+	config, err := readAllFile(filepath.Join(commonDir, "config"), x.ext)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return errors.Wrapf(err, "Fail to read config of git repository %s", commonDir)
+	}
+	x.gitRemotes = parseGitRemotes(string(config))
+
+	return nil
+}
+
+// findGitDir looks up git directory from dir to root. commonDir differs from
+// gitDir in worktree.
+func findGitDir(dir string, ext ExtIOFunc) (string, string, error) {
+	dir = filepath.Clean(dir)
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if _, err := readAllFile(filepath.Join(dotGit, "HEAD"), ext); err == nil {
+			return dotGit, dotGit, nil
+		}
+
+		// .git is a file that has `gitdir: path` in worktree and submodule
+		if raw, err := readAllFile(dotGit, ext); err == nil && strings.HasPrefix(string(raw), "gitdir:") {
+			gitDir := expandPath(strings.TrimSpace(strings.TrimPrefix(string(raw), "gitdir:")), dir, ext)
+			commonDir := gitDir
+			if common, err := readAllFile(filepath.Join(gitDir, "commondir"), ext); err == nil {
+				commonDir = expandPath(strings.TrimSpace(string(common)), gitDir, ext)
+			}
+			return gitDir, commonDir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+// parseGitRemotes returns URLs of remotes in git config.
+func parseGitRemotes(config string) []string {
+	var remotes []string
+	inRemote := false
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inRemote = strings.HasPrefix(line, "[remote ")
+			continue
+		}
+		if !inRemote {
+			continue
+		}
+
+		if pos := strings.Index(line, "="); pos >= 0 && strings.TrimSpace(line[:pos]) == "url" {
+			remotes = append(remotes, strings.TrimSpace(line[pos+1:]))
+		}
+	}
+
+	return remotes
+}
@@ -0,0 +1,149 @@
+package main_test
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const conditionTestConfig = `
+[global]
+define = ["BASE=1"]
+
+[global.when]
+env = { CONDITION_TEST = "on" }
+
+[workdir.repo]
+dirpath = "/work/repo"
+define = ["REPO=1"]
+
+[workdir.repo.when]
+gitBranch = "release/*"
+
+[workdir.org]
+dirpath = "/work"
+define = ["ORG=1"]
+
+[workdir.org.when]
+gitRemote = "*github.com:example/*"
+
+[profile.ci]
+extends = ["base"]
+define = ["CI=1"]
+
+[profile.ci.when]
+hostname = "runner-*"
+fileExists = "package.json"
+
+[profile.base]
+define = ["PROFILE_BASE=1"]
+
+[profile.tf]
+define = ["TF=1"]
+
+[profile.tf.when]
+command = "terraform"
+os = "` + runtime.GOOS + `"
+`
+
+type conditionTestEnv struct {
+	hostname string
+	environ  []string
+	files    map[string]string
+}
+
+func runConditionTest(env conditionTestEnv, args ...string) (string, error) {
+	files := map[string]string{
+		"testconfig": conditionTestConfig,
+	}
+	for k, v := range env.files {
+		files[k] = v
+	}
+
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, files, "/work/repo/src", env.environ...)
+	params.ExtIO.Hostname = func() (string, error) { return env.hostname, nil }
+	err := NewApp(params).Run(newArgs(append([]string{"-c", "testconfig"}, args...)...))
+	return buf.String(), err
+}
+
+func TestConditionNotMatched(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{hostname: "laptop"})
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+}
+
+func TestConditionEnv(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{environ: []string{"CONDITION_TEST=on"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"BASE": "1"}, toEnvVars(bytes.NewBufferString(out)))
+}
+
+func TestConditionGitBranchAndRemote(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{
+		files: map[string]string{
+			"/work/repo/.git/HEAD": "ref: refs/heads/release/v1.2\n",
+			"/work/repo/.git/config": `[core]
+	bare = false
+[remote "origin"]
+	url = git@github.com:example/repo.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+`,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"REPO": "1", "ORG": "1"}, toEnvVars(bytes.NewBufferString(out)))
+}
+
+func TestConditionGitWorktree(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{
+		files: map[string]string{
+			"/work/repo/.git":                         "gitdir: /src/main/.git/worktrees/repo\n",
+			"/src/main/.git/worktrees/repo/HEAD":      "ref: refs/heads/main\n",
+			"/src/main/.git/worktrees/repo/commondir": "../..\n",
+			"/src/main/.git/config": `[remote "upstream"]
+	url = https://github.com/other/repo.git
+[remote "origin"]
+	url = git@github.com:example/repo.git
+`,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ORG": "1"}, toEnvVars(bytes.NewBufferString(out)))
+}
+
+func TestConditionHostnameAndFile(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{
+		hostname: "runner-42",
+		files:    map[string]string{"/work/repo/src/package.json": "{}"},
+	}, "-p", "ci")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"CI": "1", "PROFILE_BASE": "1"}, toEnvVars(bytes.NewBufferString(out)))
+}
+
+func TestConditionSkipsExtends(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{hostname: "runner-42"}, "-p", "ci")
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+}
+
+func TestConditionCommand(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{}, "-p", "tf", "/usr/local/bin/terraform", "plan")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TF": "1"}, toEnvVars(bytes.NewBufferString(out)))
+
+	out, err = runConditionTest(conditionTestEnv{}, "-p", "tf", "aws", "s3", "ls")
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+}
+
+func TestConditionProvenance(t *testing.T) {
+	out, err := runConditionTest(conditionTestEnv{hostname: "laptop"}, "-p", "ci", "--provenance")
+	require.NoError(t, err)
+	assert.Contains(t, out, "#   skipped [global] in testconfig (when condition is not matched)\n")
+	assert.Contains(t, out, "#   skipped [profile.ci] in testconfig (when condition is not matched)\n")
+}
@@ -2,48 +2,10 @@ package main
 
 import (
 	"fmt"
-	"io"
-	"io/ioutil"
-	"os"
-	"strings"
-
-	toml "github.com/pelletier/go-toml"
-	"github.com/pkg/errors"
+	"reflect"
+	"sort"
 )
 
-// loadConfigFile reads config from path and update params. It's destructive function.
-func loadConfigFile(path string, profile string, ext ExtIOFunc) (*altenvConfig, error) {
-	fd, err := ext.OpenFunc(path)
-	if os.IsNotExist(err) {
-		// Ignore if path is default
-		if path != defaultConfigPath {
-			return nil, fmt.Errorf("Config file is not found: %s", path)
-		}
-
-		logger.WithField("path", path).Debug("Config file does not exist")
-		return nil, nil
-	} else if err != nil {
-		return nil, errors.Wrapf(err, "Fail to open config file: %s", path)
-	}
-	defer fd.Close()
-
-	cwd, err := ext.Getwd()
-	if err != nil {
-		return nil, errors.Wrap(err, "Fail to get CWD")
-	}
-	if !strings.HasSuffix(cwd, "/") {
-		cwd += "/" // Add slash at tail if not exists
-	}
-
-	return parseConfigFile(fd, profile, cwd)
-}
-
-type configFile struct {
-	Global   altenvConfig            `toml:"global"`
-	Profiles map[string]altenvConfig `toml:"profile"`
-	Workdirs map[string]altenvConfig `toml:"workdir"`
-}
-
 type overwritePolicy int
 
 const (
@@ -58,18 +20,101 @@ var overwritePolicyMap = map[string]overwritePolicy{
 	"allow": overwriteAllow,
 }
 
+// hostEnvPolicy decides what to do when a variable is already set in the
+// inherited (host) environment.
+type hostEnvPolicy int
+
+const (
+	hostEnvReplace = iota
+	hostEnvKeep
+	hostEnvDeny
+)
+
+var hostEnvPolicyMap = map[string]hostEnvPolicy{
+	"replace": hostEnvReplace,
+	"keep":    hostEnvKeep,
+	"deny":    hostEnvDeny,
+}
+
+// nestedPolicy decides what to do when altenv is invoked in environment
+// where a profile is already activated by altenv.
+type nestedPolicy int
+
+const (
+	nestedWarn = iota
+	nestedDeny
+	nestedAllow
+)
+
+var nestedPolicyMap = map[string]nestedPolicy{
+	"warn":  nestedWarn,
+	"deny":  nestedDeny,
+	"allow": nestedAllow,
+}
+
+// hookPolicy decides what to do when a pre or post hook command fails.
+type hookPolicy int
+
+const (
+	hookAbort = iota
+	hookWarn
+	hookIgnore
+)
+
+var hookPolicyMap = map[string]hookPolicy{
+	"abort":  hookAbort,
+	"warn":   hookWarn,
+	"ignore": hookIgnore,
+}
+
 type altenvConfig struct {
 	EnvFiles  []string `toml:"envfile"`
 	JSONFiles []string `toml:"jsonfile"`
-	Defines   []string `toml:"define"`
-	Keychains []string `toml:"keychain"`
-	Overwrite *string  `toml:"overwrite"`
+	YAMLFiles []string `toml:"yamlfile"`
+	TOMLFiles []string `toml:"tomlfile"`
+	K8sFiles  []string `toml:"k8sfile"`
+	// ComposeFiles is list of `docker-compose.yml:service` style entries
+	ComposeFiles []string `toml:"compose"`
+	Defines      []string `toml:"define"`
+	Keychains    []string `toml:"keychain"`
+	Overwrite    *string  `toml:"overwrite"`
+	HostEnv      *string  `toml:"hostenv"`
+	Nested       *string  `toml:"nested"`
+	Template     *bool    `toml:"template"`
+	Supervise    *bool    `toml:"supervise"`
+	Redact       *bool    `toml:"redact"`
+	// Dotenv is environment name of .env cascade
+	Dotenv *string `toml:"dotenv"`
+	// Secrets is list of key patterns whose value is masked in output
+	Secrets []string `toml:"secret"`
+	// TempFiles is list of `KEY=CONTENT` entries. CONTENT is written to a temp
+	// file and KEY has path of the file
+	TempFiles []string `toml:"file"`
+	// PreHooks and PostHooks are shell commands run before and after command
+	PreHooks   []string `toml:"pre"`
+	PostHooks  []string `toml:"post"`
+	HookPolicy *string  `toml:"hookPolicy"`
+
+	// Options for structured data file (JSON, YAML and TOML)
+	Coerce           *bool   `toml:"coerce"`
+	Flatten          *bool   `toml:"flatten"`
+	FlattenSeparator *string `toml:"flattenSeparator"`
+	ArrayFormat      *string `toml:"arrayFormat"`
+	ArraySeparator   *string `toml:"arraySeparator"`
 
 	KeychainServicePrefix string `toml:"keychainServicePrefix"`
 
 	// Config identifiers
-	// DirPath is read in all section, but available only in WorkDir
-	DirPath string `toml:"dirpath"`
+	// DirPath and Exclude are read in all section, but available only in WorkDir
+	DirPath string   `toml:"dirpath"`
+	Exclude []string `toml:"exclude"`
+	// Extends is available only in Profile
+	Extends []string `toml:"extends"`
+
+	// Reset is list of fields that are cleared before merging the section
+	Reset []string `toml:"reset"`
+	// When is conditions to apply the section
+	When *sectionCondition `toml:"when"`
 
 	// Only available by CLI option
 	Prompt                 string `toml:"-"`
@@ -77,16 +122,147 @@ type altenvConfig struct {
 	WriteKeychainNamespace string `toml:"-"`
 
 	overwrite overwritePolicy
+	hostEnv   hostEnvPolicy
+	nested    nestedPolicy
+	hook      hookPolicy
+	template  bool
+	supervise bool
+	redact    bool
+
+	structOptions structOptions
+
+	// dotenvDir is directory of .env cascade, and dotenvFiles is existing
+	// files of the cascade from lowest to highest priority
+	dotenvDir   string
+	dotenvFiles []string
+
+	// configFiles is list of loaded config files in precedence order (lowest first)
+	configFiles []string
+	// section is name of config section, e.g. `[global] in ~/.altenv`
+	section string
+	// provenance is history of merged sections and reset fields
+	provenance []string
+}
+
+// resolvePaths resolves file paths in the section from baseDir.
+func (x *altenvConfig) resolvePaths(baseDir string, ext ExtIOFunc) {
+	x.EnvFiles = resolveFileEntries(x.EnvFiles, baseDir, ext)
+	x.JSONFiles = resolveFileEntries(x.JSONFiles, baseDir, ext)
+	x.YAMLFiles = resolveFileEntries(x.YAMLFiles, baseDir, ext)
+	x.TOMLFiles = resolveFileEntries(x.TOMLFiles, baseDir, ext)
+	x.K8sFiles = resolveFileEntries(x.K8sFiles, baseDir, ext)
+
+	var composeFiles []string
+	for _, entry := range x.ComposeFiles {
+		if fpath, service, err := splitComposeEntry(entry); err == nil {
+			entry = resolveFileEntry(fpath, baseDir, ext) + ":" + service
+		}
+		composeFiles = append(composeFiles, entry)
+	}
+	x.ComposeFiles = composeFiles
+}
+
+// resettableFields is map of toml field name to index of altenvConfig field.
+// Identifiers of section can not be reset.
+var resettableFields = func() map[string]int {
+	fields := map[string]int{}
+	t := reflect.TypeOf(altenvConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("toml")
+		switch name {
+		case "", "-", "dirpath", "exclude", "extends", "reset", "when":
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}()
+
+// validateReset checks field names in `reset` of the section.
+func (x *altenvConfig) validateReset() error {
+	for _, name := range x.Reset {
+		if _, ok := resettableFields[name]; !ok {
+			return fmt.Errorf("`%s` in reset of %s is not resettable field", name, x.section)
+		}
+	}
+	return nil
+}
+
+// resetField clears a field specified by toml field name.
+func (x *altenvConfig) resetField(name string) {
+	idx, ok := resettableFields[name]
+	if !ok {
+		return
+	}
+	field := reflect.ValueOf(x).Elem().Field(idx)
+	field.Set(reflect.Zero(field.Type()))
 }
 
 func (x *altenvConfig) merge(src altenvConfig) {
+	x.configFiles = append(x.configFiles, src.configFiles...)
+	x.provenance = append(x.provenance, src.provenance...)
+	for _, name := range src.Reset {
+		x.resetField(name)
+		x.provenance = append(x.provenance, fmt.Sprintf("`%s` is reset by %s", name, src.section))
+	}
+	if src.section != "" {
+		x.provenance = append(x.provenance, fmt.Sprintf("merged %s", src.section))
+	}
+
 	x.EnvFiles = append(x.EnvFiles, src.EnvFiles...)
 	x.JSONFiles = append(x.JSONFiles, src.JSONFiles...)
+	x.YAMLFiles = append(x.YAMLFiles, src.YAMLFiles...)
+	x.TOMLFiles = append(x.TOMLFiles, src.TOMLFiles...)
+	x.K8sFiles = append(x.K8sFiles, src.K8sFiles...)
+	x.ComposeFiles = append(x.ComposeFiles, src.ComposeFiles...)
 	x.Defines = append(x.Defines, src.Defines...)
 	x.Keychains = append(x.Keychains, src.Keychains...)
+	x.Secrets = append(x.Secrets, src.Secrets...)
+	x.TempFiles = append(x.TempFiles, src.TempFiles...)
+	x.PreHooks = append(x.PreHooks, src.PreHooks...)
+	x.PostHooks = append(x.PostHooks, src.PostHooks...)
+	if src.HookPolicy != nil {
+		x.HookPolicy = src.HookPolicy
+	}
 	if src.Overwrite != nil {
 		x.Overwrite = src.Overwrite
 	}
+	if src.HostEnv != nil {
+		x.HostEnv = src.HostEnv
+	}
+	if src.Nested != nil {
+		x.Nested = src.Nested
+	}
+	if src.Template != nil {
+		x.Template = src.Template
+	}
+	if src.Supervise != nil {
+		x.Supervise = src.Supervise
+	}
+	if src.Redact != nil {
+		x.Redact = src.Redact
+	}
+	if src.Dotenv != nil {
+		x.Dotenv = src.Dotenv
+	}
+	if src.dotenvDir != "" {
+		x.dotenvDir = src.dotenvDir
+	}
+	if src.Coerce != nil {
+		x.Coerce = src.Coerce
+	}
+	if src.Flatten != nil {
+		x.Flatten = src.Flatten
+	}
+	if src.FlattenSeparator != nil {
+		x.FlattenSeparator = src.FlattenSeparator
+	}
+	if src.ArrayFormat != nil {
+		x.ArrayFormat = src.ArrayFormat
+	}
+	if src.ArraySeparator != nil {
+		x.ArraySeparator = src.ArraySeparator
+	}
 	if src.KeychainServicePrefix != "" {
 		x.KeychainServicePrefix = src.KeychainServicePrefix
 	}
@@ -113,14 +289,79 @@ func (x *altenvConfig) finalize() error {
 	}
 	x.overwrite = policy
 
+	if x.HostEnv == nil {
+		replace := "replace"
+		x.HostEnv = &replace
+	}
+
+	hostPolicy, ok := hostEnvPolicyMap[*x.HostEnv]
+	if !ok {
+		return fmt.Errorf("`%s` is not valid hostenv option, must be [replace|keep|deny]", *x.HostEnv)
+	}
+	x.hostEnv = hostPolicy
+
+	if x.Nested == nil {
+		warn := "warn"
+		x.Nested = &warn
+	}
+
+	nested, ok := nestedPolicyMap[*x.Nested]
+	if !ok {
+		return fmt.Errorf("`%s` is not valid nested option, must be [warn|deny|allow]", *x.Nested)
+	}
+	x.nested = nested
+
+	if x.HookPolicy == nil {
+		abort := "abort"
+		x.HookPolicy = &abort
+	}
+
+	hook, ok := hookPolicyMap[*x.HookPolicy]
+	if !ok {
+		return fmt.Errorf("`%s` is not valid hookPolicy option, must be [abort|warn|ignore]", *x.HookPolicy)
+	}
+	x.hook = hook
+
+	x.template = x.Template != nil && *x.Template
+	x.redact = x.Redact != nil && *x.Redact
+	// Redaction, temp files and post hooks require altenv to wait for exit of
+	// the command
+	x.supervise = (x.Supervise != nil && *x.Supervise) || x.redact || len(x.TempFiles) > 0 || len(x.PostHooks) > 0
+
+	x.structOptions = structOptions{
+		Coerce:         x.Coerce != nil && *x.Coerce,
+		Flatten:        x.Flatten != nil && *x.Flatten,
+		Separator:      "_",
+		ArrayFormat:    arrayFormatDeny,
+		ArraySeparator: ",",
+	}
+	if x.FlattenSeparator != nil {
+		x.structOptions.Separator = *x.FlattenSeparator
+	}
+	if x.ArraySeparator != nil {
+		x.structOptions.ArraySeparator = *x.ArraySeparator
+	}
+	if x.ArrayFormat != nil {
+		switch *x.ArrayFormat {
+		case arrayFormatDeny, arrayFormatJoin, arrayFormatJSON:
+			x.structOptions.ArrayFormat = *x.ArrayFormat
+		default:
+			return fmt.Errorf("`%s` is not valid arrayFormat option, must be [deny|join|json]", *x.ArrayFormat)
+		}
+	}
+
 	return nil
 }
 
 func parametersToConfig(params parameters) *altenvConfig {
-	config := &altenvConfig{}
+	config := &altenvConfig{section: "command line options"}
 
 	config.EnvFiles = append(config.EnvFiles, params.EnvFiles.Value()...)
 	config.JSONFiles = append(config.JSONFiles, params.JSONFiles.Value()...)
+	config.YAMLFiles = append(config.YAMLFiles, params.YAMLFiles.Value()...)
+	config.TOMLFiles = append(config.TOMLFiles, params.TOMLFiles.Value()...)
+	config.K8sFiles = append(config.K8sFiles, params.K8sFiles.Value()...)
+	config.ComposeFiles = append(config.ComposeFiles, params.ComposeFiles.Value()...)
 	config.Defines = append(config.Defines, params.Defines.Value()...)
 
 	config.Keychains = append(config.Keychains, params.Keychains.Value()...)
@@ -133,46 +374,133 @@ func parametersToConfig(params parameters) *altenvConfig {
 	if params.Overwrite != "" {
 		config.Overwrite = &params.Overwrite
 	}
+	if params.HostEnv != "" {
+		config.HostEnv = &params.HostEnv
+	}
+	if params.Nested != "" {
+		config.Nested = &params.Nested
+	}
+	if params.Template {
+		config.Template = &params.Template
+	}
+	if params.Supervise {
+		config.Supervise = &params.Supervise
+	}
+	if params.Redact {
+		config.Redact = &params.Redact
+	}
+	if params.Dotenv != "" {
+		config.Dotenv = &params.Dotenv
+	}
+	if params.Coerce {
+		config.Coerce = &params.Coerce
+	}
+	if params.Flatten {
+		config.Flatten = &params.Flatten
+	}
+	if params.FlattenSeparator != "" {
+		config.FlattenSeparator = &params.FlattenSeparator
+	}
+	if params.ArrayFormat != "" {
+		config.ArrayFormat = &params.ArrayFormat
+	}
+	if params.ArraySeparator != "" {
+		config.ArraySeparator = &params.ArraySeparator
+	}
 
 	return config
 }
 
-func parseConfigFile(fd io.Reader, profile, cwd string) (*altenvConfig, error) {
-	var fileCfg configFile
+// configContext is condition to select sections of config files.
+type configContext struct {
+	profiles []string
+	cwds     []string // current working directory and its symlink resolved path
+	cond     *conditionContext
+	ext      ExtIOFunc
+}
+
+// skipSection records the section that is not applied because of `when`.
+func (x *altenvConfig) skipSection(section string) {
+	logger.WithField("section", section).Debug("Skip config section by when condition")
+	x.provenance = append(x.provenance, fmt.Sprintf("skipped %s (when condition is not matched)", section))
+}
+
+// parseConfigFile merges sections of config files. Sections are merged by
+// order of global, workdir and profile. Within each type of section, files
+// are layered in the given order.
+func parseConfigFile(files []*configFile, ctx configContext) (*altenvConfig, error) {
 	var config altenvConfig
 
-	raw, err := ioutil.ReadAll(fd)
-	if err != nil {
-		return nil, errors.Wrap(err, "Fail to read data from config file")
+	var profiles []string
+	for _, profile := range ctx.profiles {
+		if !hasProfile(files, profile) {
+			if defaultProfileName != profile {
+				return nil, fmt.Errorf("profile `%s` is not found in config file", profile)
+			}
+			logger.Debug("profile is default, but no default profile in config")
+			continue
+		}
+		profiles = append(profiles, profile)
 	}
 
-	if err := toml.Unmarshal(raw, &fileCfg); err != nil {
-		return nil, errors.Wrap(err, "Fail to parse toml config file")
+	profileCfgs, skippedProfiles, err := resolveProfiles(files, profiles, ctx.cond)
+	if err != nil {
+		return nil, err
 	}
 
-	profileCfg, ok := fileCfg.Profiles[profile]
-	if !ok {
-		if defaultProfileName != profile {
-			return nil, fmt.Errorf("profile `%s` is not found in config file", profile)
+	var dirMatches []workdirMatch
+	for i, file := range files {
+		var labels []string
+		for k := range file.Workdirs {
+			labels = append(labels, k)
 		}
-		logger.Debug("profile is default, but no default profile in config")
-	}
-
-	var dirCfgs []altenvConfig
-	for k, dir := range fileCfg.Workdirs {
-		if dir.DirPath == "" {
-			return nil, fmt.Errorf("workdir config `%s` has no `dirpath` field", k)
+		sort.Strings(labels)
+
+		for _, k := range labels {
+			dir := file.Workdirs[k]
+			if dir.DirPath == "" {
+				return nil, fmt.Errorf("workdir config `%s` has no `dirpath` field in %s", k, file.path)
+			}
+			if !matchWorkdir(dir, ctx.cwds, ctx.ext) {
+				continue
+			}
+			if ok, err := matchCondition(dir.When, ctx.cond); err != nil {
+				return nil, err
+			} else if !ok {
+				config.skipSection(dir.section)
+				continue
+			}
+
+			dirMatches = append(dirMatches, workdirMatch{
+				label:   k,
+				dirPath: expandConfigPath(dir.DirPath, "", ctx.ext),
+				order:   i,
+				config:  dir,
+			})
 		}
-		if strings.HasPrefix(cwd, dir.DirPath) {
-			dirCfgs = append(dirCfgs, dir)
+	}
+	sortWorkdirMatches(dirMatches)
+
+	for _, file := range files {
+		config.configFiles = append(config.configFiles, file.path)
+		if ok, err := matchCondition(file.Global.When, ctx.cond); err != nil {
+			return nil, err
+		} else if !ok {
+			config.skipSection(file.Global.section)
+			continue
 		}
+		config.merge(file.Global)
 	}
-
-	config.merge(fileCfg.Global)
-	for _, dirCfg := range dirCfgs {
-		config.merge(dirCfg)
+	for _, match := range dirMatches {
+		logger.WithField("workdir", match.label).Debug("Apply workdir config")
+		config.merge(match.config)
+	}
+	for _, section := range skippedProfiles {
+		config.skipSection(section)
+	}
+	for _, profileCfg := range profileCfgs {
+		config.merge(profileCfg)
 	}
-	config.merge(profileCfg)
 
 	return &config, nil
 }
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+const projectConfigName = ".altenv.toml"
+
+type configFile struct {
+	Include  []string                `toml:"include"`
+	Global   altenvConfig            `toml:"global"`
+	Profiles map[string]altenvConfig `toml:"profile"`
+	Workdirs map[string]altenvConfig `toml:"workdir"`
+
+	path    string
+	raw     []byte
+	hash    string
+	project bool // true if the file is discovered from working directory
+}
+
+// loadConfigFile reads config files and merges them by precedence order
+// (lowest first):
+//  1. $XDG_CONFIG_HOME/altenv/config.toml (~/.config/altenv/config.toml)
+//  2. path (~/.altenv by default, can be changed by -c option)
+//  3. .altenv.toml in parent directories of CWD, from root to CWD
+//
+// Included files have lower precedence than the including file.
+func loadConfigFile(path string, profile string, args []string, ext ExtIOFunc) (*altenvConfig, error) {
+	cwd, err := ext.Getwd()
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail to get CWD")
+	}
+
+	loader := newConfigLoader(ext)
+
+	if _, err := loader.load(xdgConfigPath(ext), false); err != nil {
+		return nil, err
+	}
+
+	found, err := loader.load(path, false)
+	if err != nil {
+		return nil, err
+	} else if !found {
+		// Ignore if path is default
+		if path != defaultConfigPath {
+			return nil, fmt.Errorf("Config file is not found: %s", path)
+		}
+		logger.WithField("path", path).Debug("Config file does not exist")
+	}
+
+	for _, projectPath := range projectConfigPaths(cwd) {
+		if _, err := loader.load(projectPath, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(loader.files) == 0 {
+		return nil, nil
+	}
+
+	ctx := configContext{
+		profiles: splitProfiles(profile),
+		cwds:     []string{cwd},
+		cond:     &conditionContext{cwd: cwd, args: args, ext: ext},
+		ext:      ext,
+	}
+	if resolved, err := ext.evalSymlinks(cwd); err == nil && resolved != cwd {
+		ctx.cwds = append(ctx.cwds, resolved)
+	}
+
+	return parseConfigFile(loader.files, ctx)
+}
+
+// xdgConfigPath returns altenv config file path in XDG config directory.
+func xdgConfigPath(ext ExtIOFunc) string {
+	base := ext.getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		base = filepath.Join(homeDir(ext), ".config")
+	}
+	return filepath.Join(base, "altenv", "config.toml")
+}
+
+// projectConfigPaths returns candidates of project config file from root
+// directory to cwd.
+func projectConfigPaths(cwd string) []string {
+	var paths []string
+	dir := filepath.Clean(cwd)
+	for {
+		paths = append([]string{filepath.Join(dir, projectConfigName)}, paths...)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return paths
+}
+
+// setSections sets section name to each section and validates them.
+func (x *configFile) setSections() error {
+	x.Global.section = fmt.Sprintf("[global] in %s", x.path)
+	if err := x.Global.validateReset(); err != nil {
+		return err
+	}
+
+	for name, section := range x.Profiles {
+		section.section = fmt.Sprintf("[profile.%s] in %s", name, x.path)
+		if err := section.validateReset(); err != nil {
+			return err
+		}
+		x.Profiles[name] = section
+	}
+	for name, section := range x.Workdirs {
+		section.section = fmt.Sprintf("[workdir.%s] in %s", name, x.path)
+		if err := section.validateReset(); err != nil {
+			return err
+		}
+		x.Workdirs[name] = section
+	}
+
+	return nil
+}
+
+// resolvePaths resolves file paths in sections. Relative paths are resolved
+// from directory of the config file, or from `dirpath` in workdir section.
+func (x *configFile) resolvePaths(ext ExtIOFunc) {
+	baseDir := filepath.Dir(x.path)
+
+	x.Global.resolvePaths(baseDir, ext)
+	for name, section := range x.Profiles {
+		section.resolvePaths(baseDir, ext)
+		x.Profiles[name] = section
+	}
+	for name, section := range x.Workdirs {
+		// Glob pattern of dirpath can not be base directory
+		dirPath := expandConfigPath(section.DirPath, "", ext)
+		if section.DirPath == "" || hasGlobMeta(dirPath) {
+			section.resolvePaths(baseDir, ext)
+		} else {
+			section.resolvePaths(dirPath, ext)
+			// .env cascade is loaded from dirpath of matched workdir that
+			// sets dotenv
+			if section.Dotenv != nil {
+				section.dotenvDir = dirPath
+			}
+		}
+		x.Workdirs[name] = section
+	}
+}
+
+type configLoader struct {
+	ext     ExtIOFunc
+	visited map[string]bool
+	files   []*configFile
+
+	// checkTrust enables verification of project config files by trust DB
+	checkTrust bool
+	trust      *trustDB
+}
+
+func newConfigLoader(ext ExtIOFunc) *configLoader {
+	return &configLoader{
+		ext:        ext,
+		visited:    map[string]bool{},
+		checkTrust: true,
+	}
+}
+
+func (x *configLoader) verifyTrust(path string, raw []byte) error {
+	if x.trust == nil {
+		db, err := loadTrustDB(x.ext)
+		if err != nil {
+			return err
+		}
+		x.trust = db
+	}
+
+	return x.trust.verify(path, raw)
+}
+
+// load reads a config file and included files. It returns false if the
+// file does not exist.
+func (x *configLoader) load(path string, project bool) (bool, error) {
+	if x.visited[path] {
+		logger.WithField("path", path).Debug("Config file is already loaded")
+		return true, nil
+	}
+
+	fd, err := x.ext.OpenFunc(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "Fail to open config file: %s", path)
+	}
+	defer fd.Close()
+	x.visited[path] = true
+
+	raw, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return false, errors.Wrapf(err, "Fail to read data from config file: %s", path)
+	}
+
+	// Project config file may come from untrusted repository, then it must
+	// be allowed by user before loading.
+	if project && x.checkTrust {
+		if err := x.verifyTrust(path, raw); err != nil {
+			return false, err
+		}
+	}
+
+	var file configFile
+	if err := toml.Unmarshal(raw, &file); err != nil {
+		return false, errors.Wrapf(err, "Fail to parse toml config file: %s", path)
+	}
+	file.path = path
+	file.raw = raw
+	file.hash = contentHash(raw)
+	file.project = project
+	if err := file.setSections(); err != nil {
+		return false, err
+	}
+	file.resolvePaths(x.ext)
+	logger.WithField("path", path).Debug("Loaded config file")
+
+	for _, include := range file.Include {
+		pattern := expandConfigPath(include, filepath.Dir(path), x.ext)
+		matches, err := x.ext.glob(pattern)
+		if err != nil {
+			return false, errors.Wrapf(err, "Invalid include pattern `%s` in %s", include, path)
+		}
+
+		for _, match := range matches {
+			found, err := x.load(match, project)
+			if err != nil {
+				return false, err
+			} else if !found {
+				return false, fmt.Errorf("Included config file is not found: %s (in %s)", match, path)
+			}
+		}
+	}
+
+	x.files = append(x.files, &file)
+	return true, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// sortedGlob returns sorted file paths matched with pattern. pattern itself is
+// returned if it has no glob meta character.
+func sortedGlob(pattern string, glob globFunc) ([]string, error) {
+	if !hasGlobMeta(pattern) {
+		return []string{pattern}, nil
+	}
+
+	matches, err := glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
@@ -0,0 +1,203 @@
+package main_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allowProjectFiles adds trust DB that allows all project config files.
+func allowProjectFiles(files map[string]string) {
+	db := map[string]map[string]string{"files": {}}
+	for path, data := range files {
+		if strings.HasPrefix(path, "/work/") {
+			hash := sha256.Sum256([]byte(data))
+			db["files"][path] = hex.EncodeToString(hash[:])
+		}
+	}
+	raw, _ := json.Marshal(db)
+	files["/home/blue/.local/share/altenv/trust.json"] = string(raw)
+}
+
+func newLayeredConfigTestParams(buf *bytes.Buffer, files map[string]string) *Parameters {
+	return newTestParams(buf, files, "/work/proj1/src", "HOME=/home/blue", "XDG_CONFIG_HOME=/home/blue/.xdg")
+}
+
+func TestConfigLayeredFiles(t *testing.T) {
+	files := map[string]string{
+		"/home/blue/.xdg/altenv/config.toml": `
+[global]
+define = ["XDG=1", "COLOR=xdg"]
+overwrite = "allow"
+`,
+		"testconfig": `
+[global]
+define = ["USER=1", "COLOR=user"]
+`,
+		"/work/.altenv.toml": `
+[global]
+define = ["COLOR=work"]
+`,
+		"/work/proj1/.altenv.toml": `
+include = ["altenv.d/*.toml"]
+
+[global]
+define = ["COLOR=proj1"]
+
+[profile.dev]
+define = ["PROFILE=dev"]
+`,
+		"/work/proj1/altenv.d/a.toml": `
+[global]
+define = ["INCLUDED=a"]
+`,
+		"/work/proj1/altenv.d/b.toml": `
+[global]
+define = ["INCLUDED=b"]
+`,
+	}
+
+	allowProjectFiles(files)
+
+	buf := &bytes.Buffer{}
+	app := NewApp(newLayeredConfigTestParams(buf, files))
+	err := app.Run(newArgs("-l", "error", "-c", "testconfig", "-p", "dev"))
+	require.NoError(t, err)
+
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "1", envmap["XDG"])
+	assert.Equal(t, "1", envmap["USER"])
+	assert.Equal(t, "proj1", envmap["COLOR"])
+	assert.Equal(t, "b", envmap["INCLUDED"])
+	assert.Equal(t, "dev", envmap["PROFILE"])
+}
+
+func TestConfigProvenance(t *testing.T) {
+	files := map[string]string{
+		"testconfig": `
+[global]
+define = ["COLOR=user"]
+`,
+		"/work/proj1/.altenv.toml": `
+[global]
+define = ["MAGIC=5"]
+`,
+	}
+
+	allowProjectFiles(files)
+
+	buf := &bytes.Buffer{}
+	app := NewApp(newLayeredConfigTestParams(buf, files))
+	err := app.Run(newArgs("-c", "testconfig", "--provenance"))
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.Join([]string{
+		"# config files (lowest to highest precedence)",
+		"#   1. testconfig",
+		"#   2. /work/proj1/.altenv.toml",
+		"# config merge history",
+		"#   merged [global] in testconfig",
+		"#   merged [global] in /work/proj1/.altenv.toml",
+		"#   merged command line options",
+		"# COLOR from define",
+		"COLOR=user",
+		"# MAGIC from define",
+		"MAGIC=5",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestConfigIncludeNotFound(t *testing.T) {
+	files := map[string]string{
+		"testconfig": `include = ["common.toml"]`,
+	}
+
+	buf := &bytes.Buffer{}
+	app := NewApp(newLayeredConfigTestParams(buf, files))
+	err := app.Run(newArgs("-c", "testconfig"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Included config file is not found: common.toml")
+}
+
+func TestConfigIncludeCycle(t *testing.T) {
+	files := map[string]string{
+		"/conf/a.toml": `
+include = ["b.toml"]
+[global]
+define = ["A=1"]
+`,
+		"/conf/b.toml": `
+include = ["a.toml"]
+[global]
+define = ["B=1"]
+`,
+	}
+
+	buf := &bytes.Buffer{}
+	app := NewApp(newLayeredConfigTestParams(buf, files))
+	err := app.Run(newArgs("-c", "/conf/a.toml"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "1", envmap["A"])
+	assert.Equal(t, "1", envmap["B"])
+}
+
+const resetTestConfig = `
+[global]
+define = ["COLOR=blue", "MAGIC=5"]
+overwrite = "allow"
+
+[workdir.proj]
+dirpath = "/some"
+define = ["WORKDIR=1"]
+
+[profile.clean]
+reset = ["define"]
+define = ["COLOR=red"]
+
+[profile.keep]
+define = ["COLOR=red"]
+`
+
+func TestConfigResetField(t *testing.T) {
+	vars, err := runProfileTest(resetTestConfig, "-p", "clean")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "red"}, vars)
+}
+
+func TestConfigWithoutReset(t *testing.T) {
+	vars, err := runProfileTest(resetTestConfig, "-p", "keep")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "red", "MAGIC": "5", "WORKDIR": "1"}, vars)
+}
+
+func TestConfigResetPointerField(t *testing.T) {
+	vars, err := runProfileTest(`
+[global]
+overwrite = "allow"
+define = ["COLOR=blue"]
+
+[profile.strict]
+reset = ["overwrite"]
+define = ["COLOR=red"]
+`, "-p", "strict")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "COLOR")
+	assert.Empty(t, vars)
+}
+
+func TestConfigResetInvalidField(t *testing.T) {
+	_, err := runProfileTest(`
+[profile.bad]
+reset = ["dirpath"]
+`, "-p", "bad")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "`dirpath` in reset of [profile.bad] in testconfig is not resettable field")
+}
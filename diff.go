@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// diffSide is a resolved configuration to be compared.
+type diffSide struct {
+	Label   string `json:"label"`
+	vars    map[string]*envvar
+	secrets []string
+}
+
+type diffValue struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+type diffChange struct {
+	Key    string     `json:"key"`
+	Change string     `json:"change"` // added, removed or changed
+	Old    *diffValue `json:"old,omitempty"`
+	New    *diffValue `json:"new,omitempty"`
+}
+
+type diffResult struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Changes []diffChange `json:"changes"`
+}
+
+// loadDiffSide resolves variables with params in the directory. input is
+// used for --input and --prompt options instead of ExtIO.
+func loadDiffSide(params parameters, dir string, input *onceInput) (*diffSide, error) {
+	ext := input.replay(*params.ExtIO)
+	ext.Getwd = func() (string, error) { return dir, nil }
+
+	config, err := setupConfig(params, nil, ext)
+	if err != nil {
+		return nil, err
+	}
+	envvars, err := loadEnvVars(*config, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	side := &diffSide{
+		Label:   fmt.Sprintf("profile=%s dir=%s config=%s", params.Profile, dir, params.ConfigPath),
+		vars:    map[string]*envvar{},
+		secrets: config.Secrets,
+	}
+	for _, v := range envvars {
+		side.vars[v.Key] = v
+	}
+	return side, nil
+}
+
+// diffConfigs compares variables of current options and ones overridden by
+// --diff-profile, --diff-dir and --diff-config options.
+func diffConfigs(params parameters) error {
+	if params.DiffProfile == "" && params.DiffDir == "" && params.DiffConfig == "" {
+		return fmt.Errorf("One of --diff-profile, --diff-dir and --diff-config is required in diff mode")
+	}
+
+	cwd, err := params.ExtIO.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "Fail to get CWD")
+	}
+
+	// stdin and prompt are read only once and given to both sides
+	input, err := readOnceInput(params)
+	if err != nil {
+		return err
+	}
+
+	from, err := loadDiffSide(params, cwd, input)
+	if err != nil {
+		return err
+	}
+
+	toParams, toDir := params, cwd
+	if params.DiffProfile != "" {
+		toParams.Profile = params.DiffProfile
+	}
+	if params.DiffConfig != "" {
+		toParams.ConfigPath = expandPath(params.DiffConfig, cwd, *params.ExtIO)
+	}
+	if params.DiffDir != "" {
+		toDir = expandPath(params.DiffDir, cwd, *params.ExtIO)
+	}
+
+	to, err := loadDiffSide(toParams, toDir, input)
+	if err != nil {
+		return err
+	}
+
+	result := compareDiffSides(from, to)
+
+	switch params.OutputFormat {
+	case "env", "":
+		return dumpDiffText(params.ExtIO.DryRunOutput, result)
+	case "json":
+		raw, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Fail to encode diff result")
+		}
+		if _, err := fmt.Fprintln(params.ExtIO.DryRunOutput, string(raw)); err != nil {
+			return errors.Wrap(err, "Fail to output diff result")
+		}
+		return nil
+	default:
+		return fmt.Errorf("Invalid output format of diff: `%s`, must be [env|json]", params.OutputFormat)
+	}
+}
+
+// compareDiffSides returns changes sorted by key. A value is masked if it is
+// secret in either side.
+func compareDiffSides(from, to *diffSide) diffResult {
+	result := diffResult{From: from.Label, To: to.Label, Changes: []diffChange{}}
+
+	keys := map[string]bool{}
+	for key := range from.vars {
+		keys[key] = true
+	}
+	for key := range to.vars {
+		keys[key] = true
+	}
+	var sortedKeys []string
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	secrets := append(append([]string{}, from.secrets...), to.secrets...)
+	for _, key := range sortedKeys {
+		oldVar, inFrom := from.vars[key]
+		newVar, inTo := to.vars[key]
+
+		masked := (inFrom && isSecret(oldVar, secrets)) || (inTo && isSecret(newVar, secrets))
+		value := func(v *envvar) *diffValue {
+			dv := &diffValue{Value: v.Value, Source: v.Source.String()}
+			if masked {
+				dv.Value = maskedValue
+			}
+			return dv
+		}
+
+		switch {
+		case inFrom && !inTo:
+			result.Changes = append(result.Changes, diffChange{Key: key, Change: "removed", Old: value(oldVar)})
+		case !inFrom && inTo:
+			result.Changes = append(result.Changes, diffChange{Key: key, Change: "added", New: value(newVar)})
+		case oldVar.Value != newVar.Value:
+			result.Changes = append(result.Changes, diffChange{Key: key, Change: "changed", Old: value(oldVar), New: value(newVar)})
+		}
+	}
+
+	return result
+}
+
+func dumpDiffText(w io.Writer, result diffResult) error {
+	lines := []string{
+		"--- " + result.From,
+		"+++ " + result.To,
+	}
+
+	counts := map[string]int{}
+	for _, c := range result.Changes {
+		counts[c.Change]++
+		switch c.Change {
+		case "added":
+			lines = append(lines, fmt.Sprintf("+ %s=%s (from %s)", c.Key, c.New.Value, c.New.Source))
+		case "removed":
+			lines = append(lines, fmt.Sprintf("- %s=%s (from %s)", c.Key, c.Old.Value, c.Old.Source))
+		case "changed":
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s (from %s -> %s)", c.Key, c.Old.Value, c.New.Value, c.Old.Source, c.New.Source))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("%d added, %d removed, %d changed", counts["added"], counts["removed"], counts["changed"]))
+
+	if _, err := fmt.Fprintln(w, strings.Join(lines, "\n")); err != nil {
+		return errors.Wrap(err, "Fail to output diff result")
+	}
+	return nil
+}
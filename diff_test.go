@@ -0,0 +1,153 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var diffTestFiles = map[string]string{
+	"/conf/altenv.toml": `
+[global]
+secret = ["*_TOKEN"]
+
+[workdir.proj1]
+dirpath = "/work/proj1"
+define = ["PROJECT=proj1"]
+
+[profile.staging]
+define = ["STAGE=staging", "LOG_LEVEL=debug", "API_TOKEN=staging-token"]
+
+[profile.prod]
+define = ["STAGE=prod", "API_TOKEN=prod-token", "REPLICAS=3"]
+
+[profile.k8s]
+k8sfile = ["s.yaml"]
+`,
+	"/conf/s.yaml": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+stringData:
+  PW: hunter2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: db
+data:
+  DB_HOST: db.local
+`,
+	"/conf/other.toml": `
+[profile.staging]
+define = ["STAGE=staging", "LOG_LEVEL=info", "API_TOKEN=staging-token"]
+`,
+}
+
+func runDiffTest(args ...string) (string, error) {
+	return runDiffTestWithStdin("", args...)
+}
+
+func newDiffTestParams(buf *bytes.Buffer, stdin string) *Parameters {
+	params := newTestParams(buf, diffTestFiles, "/work/proj1")
+	params.ExtIO.Stdin = strings.NewReader(stdin)
+	return params
+}
+
+func runDiffTestWithStdin(stdin string, args ...string) (string, error) {
+	buf := &bytes.Buffer{}
+	params := newDiffTestParams(buf, stdin)
+	err := NewApp(params).Run(append([]string{"altenv", "-r", "diff", "-c", "/conf/altenv.toml"}, args...))
+	return buf.String(), err
+}
+
+func TestDiffProfiles(t *testing.T) {
+	out, err := runDiffTest("-p", "staging", "--diff-profile", "prod")
+	require.NoError(t, err)
+	assert.Equal(t, `--- profile=staging dir=/work/proj1 config=/conf/altenv.toml
++++ profile=prod dir=/work/proj1 config=/conf/altenv.toml
+~ API_TOKEN: ******** -> ******** (from define -> define)
+- LOG_LEVEL=debug (from define)
++ REPLICAS=3 (from define)
+~ STAGE: staging -> prod (from define -> define)
+1 added, 1 removed, 2 changed
+`, out)
+}
+
+func TestDiffDir(t *testing.T) {
+	out, err := runDiffTest("-p", "staging", "--diff-dir", "/work/proj2", "-o", "json")
+	require.NoError(t, err)
+
+	var result struct {
+		From    string `json:"from"`
+		To      string `json:"to"`
+		Changes []struct {
+			Key    string `json:"key"`
+			Change string `json:"change"`
+			Old    *struct {
+				Value  string `json:"value"`
+				Source string `json:"source"`
+			} `json:"old"`
+			New *struct{} `json:"new"`
+		} `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &result))
+	assert.Equal(t, "profile=staging dir=/work/proj2 config=/conf/altenv.toml", result.To)
+	require.Equal(t, 1, len(result.Changes))
+	assert.Equal(t, "PROJECT", result.Changes[0].Key)
+	assert.Equal(t, "removed", result.Changes[0].Change)
+	assert.Equal(t, "proj1", result.Changes[0].Old.Value)
+	assert.Nil(t, result.Changes[0].New)
+}
+
+func TestDiffConfig(t *testing.T) {
+	out, err := runDiffTest("-p", "staging", "--diff-config", "/conf/other.toml")
+	require.NoError(t, err)
+	assert.Contains(t, out, "~ LOG_LEVEL: debug -> info (from define -> define)\n")
+	assert.Contains(t, out, "- PROJECT=proj1 (from define)\n")
+	assert.NotContains(t, out, "API_TOKEN")
+}
+
+func TestDiffRequiresTarget(t *testing.T) {
+	_, err := runDiffTest("-p", "staging")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "One of --diff-profile, --diff-dir and --diff-config is required")
+}
+
+func TestDiffK8sSecret(t *testing.T) {
+	out, err := runDiffTest("-p", "staging", "--diff-profile", "k8s")
+	require.NoError(t, err)
+	assert.Contains(t, out, "+ DB_HOST=db.local (from k8sfile:/conf/s.yaml)\n")
+	assert.Contains(t, out, "+ PW=******** (from k8sfile:/conf/s.yaml)\n")
+	assert.NotContains(t, out, "hunter2")
+}
+
+func TestDiffStdin(t *testing.T) {
+	out, err := runDiffTestWithStdin("FROM_STDIN=1\n", "-p", "staging", "-i", "env", "--diff-profile", "prod")
+	require.NoError(t, err)
+	assert.NotContains(t, out, "FROM_STDIN")
+	assert.Contains(t, out, "1 added, 1 removed, 2 changed\n")
+}
+
+func TestDiffPrompt(t *testing.T) {
+	buf := &bytes.Buffer{}
+	params := newDiffTestParams(buf, "")
+	var prompted []string
+	params.ExtIO.InputFunc = func(msg string) string {
+		prompted = append(prompted, msg)
+		return fmt.Sprintf("answer%d", len(prompted))
+	}
+
+	err := NewApp(params).Run([]string{"altenv", "-r", "diff", "-c", "/conf/altenv.toml",
+		"-p", "staging", "--prompt", "PASSWORD", "--diff-profile", "prod"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Enter PASSWORD value"}, prompted)
+	assert.NotContains(t, buf.String(), "PASSWORD")
+}
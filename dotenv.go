@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// readDotenvFile reads env file and removes `export` prefix and quotes
+// around value as dotenv libraries do.
+func readDotenvFile(fpath string, ext ExtIOFunc) ([]*envvar, error) {
+	vars, err := readEnvFile(fpath, ext.OpenFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range vars {
+		v.Key = strings.TrimSpace(strings.TrimPrefix(v.Key, "export "))
+		if len(v.Value) >= 2 {
+			first, last := v.Value[0], v.Value[len(v.Value)-1]
+			if first == last && (first == '"' || first == '\'') {
+				v.Value = v.Value[1 : len(v.Value)-1]
+			}
+		}
+	}
+	return vars, nil
+}
+
+// dotenvCascade returns file names of .env cascade for the environment from
+// lowest to highest priority. `.env.local` is not used in test environment
+// to keep test results same for everyone.
+func dotenvCascade(env string) []string {
+	names := []string{".env"}
+	if env != "test" {
+		names = append(names, ".env.local")
+	}
+	if env != "" {
+		names = append(names, ".env."+env, ".env."+env+".local")
+	}
+	return names
+}
+
+// resolveDotenv looks up existing files of .env cascade. The directory is
+// dirpath of the most specific matched workdir section that sets dotenv, or
+// CWD if no such workdir section is matched.
+func (x *altenvConfig) resolveDotenv(ext ExtIOFunc) error {
+	if x.Dotenv == nil {
+		return nil
+	}
+
+	dir := x.dotenvDir
+	if dir == "" {
+		cwd, err := ext.Getwd()
+		if err != nil {
+			return errors.Wrap(err, "Fail to get CWD")
+		}
+		dir = cwd
+	}
+
+	x.dotenvFiles = nil
+	for _, name := range dotenvCascade(*x.Dotenv) {
+		path := filepath.Join(dir, name)
+		fd, err := ext.OpenFunc(path)
+		if os.IsNotExist(err) {
+			logger.WithField("path", path).Debug("Skip missing dotenv file")
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "Fail to open dotenv file %s", path)
+		}
+		fd.Close()
+		x.dotenvFiles = append(x.dotenvFiles, path)
+	}
+
+	return nil
+}
+
+// loadDotenvFiles reads .env cascade. A variable in higher priority file
+// overrides the one in lower priority file regardless of overwrite policy.
+func loadDotenvFiles(files []string, ext ExtIOFunc) loadResult {
+	varmap := map[string]*envvar{}
+	var keys []string
+
+	for _, path := range files {
+		logger.WithField("path", path).Debug("Read dotenv file")
+		vars, err := readDotenvFile(path, ext)
+		if err != nil {
+			return loadResult{nil, errors.Wrapf(err, "Fail to read dotenv file %s", path)}
+		}
+		setSource(vars, "dotenv", path)
+
+		for _, v := range vars {
+			if old, ok := varmap[v.Key]; ok {
+				logger.WithFields(logrus.Fields{
+					"key":  v.Key,
+					"from": old.Source.Path,
+					"to":   path,
+				}).Debug("Override dotenv variable")
+			} else {
+				keys = append(keys, v.Key)
+			}
+			varmap[v.Key] = v
+		}
+	}
+
+	var envvars []*envvar
+	for _, key := range keys {
+		envvars = append(envvars, varmap[key])
+	}
+	return loadResult{envvars, nil}
+}
@@ -0,0 +1,97 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dotenvTestFiles = map[string]string{
+	"/conf/altenv.toml": `
+[workdir.app]
+dirpath = "/work/app"
+dotenv = "development"
+
+[profile.test]
+dotenv = "test"
+`,
+	"/work/app/.env":                   "COLOR=base\nMAGIC=1\nLEVEL=base",
+	"/work/app/.env.local":             "COLOR=local",
+	"/work/app/.env.development":       "MAGIC=dev\nLEVEL=\"dev\"",
+	"/work/app/.env.development.local": "export LEVEL=dev-local",
+	"/work/app/.env.test":              "MAGIC=test",
+}
+
+func TestDotenvCascade(t *testing.T) {
+	vars, err := runPathTest(dotenvTestFiles, "/work/app/src", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"COLOR": "local",
+		"MAGIC": "dev",
+		"LEVEL": "dev-local",
+	}, vars)
+}
+
+func TestDotenvDirOfWorkdirWithoutDotenv(t *testing.T) {
+	files := map[string]string{}
+	for path, data := range dotenvTestFiles {
+		files[path] = data
+	}
+	files["/conf/altenv.toml"] += `
+[workdir.src]
+dirpath = "/work/app/src"
+define = ["SRC=1"]
+`
+	files["/work/app/src/.env"] = "COLOR=src"
+
+	vars, err := runPathTest(files, "/work/app/src", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"COLOR": "local",
+		"MAGIC": "dev",
+		"LEVEL": "dev-local",
+		"SRC":   "1",
+	}, vars)
+}
+
+func TestDotenvTestEnvSkipsLocal(t *testing.T) {
+	vars, err := runPathTest(dotenvTestFiles, "/work/app/src", "-c", "/conf/altenv.toml", "-p", "test")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"COLOR": "base",
+		"MAGIC": "test",
+		"LEVEL": "base",
+	}, vars)
+}
+
+func TestDotenvCLIOption(t *testing.T) {
+	files := map[string]string{
+		"/somewhere/.env":            "COLOR=base",
+		"/somewhere/.env.production": "COLOR=prod",
+	}
+
+	vars, err := runPathTest(files, "/somewhere", "--dotenv", "production")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "prod"}, vars)
+}
+
+func TestDotenvConflictWithOtherSource(t *testing.T) {
+	_, err := runPathTest(dotenvTestFiles, "/work/app/src", "-c", "/conf/altenv.toml", "-d", "COLOR=cli")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Deny to overwrite `COLOR`")
+}
+
+func TestDotenvProvenance(t *testing.T) {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, dotenvTestFiles, "/work/app")
+
+	err := NewApp(params).Run(newArgs("-c", "/conf/altenv.toml", "-p", "test", "--provenance"))
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "# dotenv files (lowest to highest priority)\n"+
+		"#   1. /work/app/.env\n"+
+		"#   2. /work/app/.env.test\n")
+	assert.Contains(t, buf.String(), "# MAGIC from dotenv:/work/app/.env.test:1\n")
+}
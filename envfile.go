@@ -49,6 +49,7 @@ func parseEnvFile(fd io.Reader) ([]*envvar, error) {
 		if err != nil {
 			return nil, errors.Wrapf(err, "Fail parse envfile at line %d", lineNo)
 		}
+		v.Source.Line = lineNo
 		envvars = append(envvars, v)
 
 		logger.WithFields(logrus.Fields{
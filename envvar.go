@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"sort"
 
 	"github.com/pkg/errors"
@@ -10,8 +12,38 @@ import (
 )
 
 type envvar struct {
-	Key   string
-	Value string
+	Key    string
+	Value  string
+	Source varSource
+
+	// secret is true if the value comes from secret resource, e.g. Kubernetes
+	// Secret, regardless of source type
+	secret bool
+}
+
+// varSource indicates where a variable is loaded from.
+type varSource struct {
+	Type string // envfile, dotenv, jsonfile, define, keychain, stdin or prompt
+	Path string // file path or keychain namespace, empty if not available
+	Line int    // line number in the file, 0 if not available
+}
+
+func (x varSource) String() string {
+	s := x.Type
+	if x.Path != "" {
+		s += ":" + x.Path
+	}
+	if x.Line > 0 {
+		s += fmt.Sprintf(":%d", x.Line)
+	}
+	return s
+}
+
+func setSource(vars []*envvar, srcType, path string) {
+	for _, v := range vars {
+		v.Source.Type = srcType
+		v.Source.Path = path
+	}
 }
 
 func dumpEnvVars(w io.Writer, vars []*envvar) error {
@@ -27,6 +59,40 @@ func dumpEnvVars(w io.Writer, vars []*envvar) error {
 	return nil
 }
 
+// dumpEnvVarsWithProvenance outputs loaded config files and source of each
+// variable as comment in addition to variables.
+func dumpEnvVarsWithProvenance(w io.Writer, vars []*envvar, config altenvConfig) error {
+	lines := []string{"# config files (lowest to highest precedence)"}
+	for i, path := range config.configFiles {
+		lines = append(lines, fmt.Sprintf("#   %d. %s", i+1, path))
+	}
+	if len(config.dotenvFiles) > 0 {
+		lines = append(lines, "# dotenv files (lowest to highest priority)")
+		for i, path := range config.dotenvFiles {
+			lines = append(lines, fmt.Sprintf("#   %d. %s", i+1, path))
+		}
+	}
+	lines = append(lines, "# config merge history")
+	for _, history := range config.provenance {
+		lines = append(lines, "#   "+history)
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Key < vars[j].Key
+	})
+	for _, v := range vars {
+		lines = append(lines, fmt.Sprintf("# %s from %s", v.Key, v.Source))
+		lines = append(lines, fmt.Sprintf("%s=%s", v.Key, v.Value))
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return errors.Wrap(err, "Fail to output dryrun results")
+		}
+	}
+	return nil
+}
+
 type loadResult struct {
 	EnvVars []*envvar
 	Error   error
@@ -37,11 +103,16 @@ func loadEnvVars(config altenvConfig, ext ExtIOFunc) ([]*envvar, error) {
 
 	// Read environment variables
 	results := []loadResult{
+		loadDotenvFiles(config.dotenvFiles, ext),
 		loadEnvFiles(config.EnvFiles, ext),
-		loadJSONFiles(config.JSONFiles, ext),
+		loadStructFiles(config.JSONFiles, "jsonfile", readJSONFile, config.structOptions, ext),
+		loadStructFiles(config.YAMLFiles, "yamlfile", readYAMLFile, config.structOptions, ext),
+		loadStructFiles(config.TOMLFiles, "tomlfile", readTOMLFile, config.structOptions, ext),
+		loadK8sFiles(config.K8sFiles, ext),
+		loadComposeFiles(config.ComposeFiles, ext),
 		loadDefines(config.Defines),
 		loadKeychain(config.Keychains, config.KeychainServicePrefix, ext),
-		loadStdin(config.Stdin, ext),
+		loadStdin(config.Stdin, config.structOptions, ext),
 		loadPrompt(config.Prompt, ext),
 	}
 
@@ -52,8 +123,13 @@ func loadEnvVars(config altenvConfig, ext ExtIOFunc) ([]*envvar, error) {
 		envvars = append(envvars, result.EnvVars...)
 	}
 
+	if err := applyModifiers(envvars, ext); err != nil {
+		return nil, err
+	}
+
 	// Check overwrite
 	varmap := map[string]*envvar{}
+	var keys []string
 	for _, v := range envvars {
 		if existValue, ok := varmap[v.Key]; ok {
 			logFields := logrus.Fields{
@@ -70,13 +146,21 @@ func loadEnvVars(config altenvConfig, ext ExtIOFunc) ([]*envvar, error) {
 			case overwriteAllow:
 				logger.WithFields(logFields).Debug("Overwrote environment variable")
 			}
+		} else {
+			keys = append(keys, v.Key)
 		}
 		varmap[v.Key] = v
 	}
 
 	var newVars []*envvar
-	for _, v := range varmap {
-		newVars = append(newVars, v)
+	for _, key := range keys {
+		newVars = append(newVars, varmap[key])
+	}
+
+	if config.template {
+		if err := renderTemplates(newVars, ext); err != nil {
+			return nil, err
+		}
 	}
 
 	return newVars, nil
@@ -85,28 +169,90 @@ func loadEnvVars(config altenvConfig, ext ExtIOFunc) ([]*envvar, error) {
 func loadEnvFiles(envFiles []string, ext ExtIOFunc) loadResult {
 	var envvars []*envvar
 
-	for _, path := range envFiles {
+	paths, err := expandFileEntries(envFiles, ext)
+	if err != nil {
+		return loadResult{nil, err}
+	}
+
+	for _, path := range paths {
 		logger.WithField("path", path).Debug("Read EnvFile")
 		vars, err := readEnvFile(path, ext.OpenFunc)
 		if err != nil {
 			return loadResult{nil, errors.Wrapf(err, "Fail to read EnvFile %s", path)}
 		}
+		setSource(vars, "envfile", path)
+
+		envvars = append(envvars, vars...)
+	}
+
+	return loadResult{envvars, nil}
+}
+
+func loadK8sFiles(k8sFiles []string, ext ExtIOFunc) loadResult {
+	var envvars []*envvar
+
+	paths, err := expandFileEntries(k8sFiles, ext)
+	if err != nil {
+		return loadResult{nil, err}
+	}
+
+	for _, path := range paths {
+		logger.WithField("path", path).Debug("Read Kubernetes manifest file")
+		vars, err := readK8sFile(path, ext.OpenFunc)
+		if err != nil {
+			return loadResult{nil, errors.Wrapf(err, "Fail to read Kubernetes manifest %s", path)}
+		}
+		setSource(vars, "k8sfile", path)
+		envvars = append(envvars, vars...)
+	}
+
+	return loadResult{envvars, nil}
+}
+
+func loadComposeFiles(entries []string, ext ExtIOFunc) loadResult {
+	var envvars []*envvar
+
+	for _, entry := range entries {
+		entry, optional := splitOptional(entry)
+		if optional {
+			fpath, _, _ := splitComposeEntry(entry)
+			if paths, err := expandFileEntries([]string{"?" + fpath}, ext); err != nil {
+				return loadResult{nil, err}
+			} else if len(paths) == 0 {
+				continue
+			}
+		}
 
+		logger.WithField("entry", entry).Debug("Read docker-compose file")
+		vars, err := readComposeFile(entry, ext)
+		if err != nil {
+			return loadResult{nil, errors.Wrapf(err, "Fail to read docker-compose %s", entry)}
+		}
+		fpath, _, _ := splitComposeEntry(entry)
+		setSource(vars, "compose", fpath)
 		envvars = append(envvars, vars...)
 	}
 
 	return loadResult{envvars, nil}
 }
 
-func loadJSONFiles(jsonFiles []string, ext ExtIOFunc) loadResult {
+type structFileReader func(fpath string, opts structOptions, open fileOpen) ([]*envvar, error)
+
+func loadStructFiles(files []string, srcType string, read structFileReader, opts structOptions, ext ExtIOFunc) loadResult {
 	var envvars []*envvar
 
-	for _, path := range jsonFiles {
-		logger.WithField("path", path).Debug("Read JSON file")
-		vars, err := readJSONFile(path, ext.OpenFunc)
+	paths, err := expandQueryFileEntries(files, ext)
+	if err != nil {
+		return loadResult{nil, err}
+	}
+
+	for _, path := range paths {
+		logger.WithFields(logrus.Fields{"path": path, "type": srcType}).Debug("Read structured data file")
+		vars, err := read(path, opts, ext.OpenFunc)
 		if err != nil {
-			return loadResult{nil, errors.Wrapf(err, "Fail to read JSON file %s", path)}
+			return loadResult{nil, errors.Wrapf(err, "Fail to read %s %s", srcType, path)}
 		}
+		setSource(vars, srcType, path)
 		envvars = append(envvars, vars...)
 	}
 
@@ -122,6 +268,7 @@ func loadDefines(defines []string) loadResult {
 		if err != nil {
 			return loadResult{nil, err}
 		}
+		v.Source.Type = "define"
 		envvars = append(envvars, v)
 	}
 
@@ -141,20 +288,25 @@ func loadKeychain(keychains []string, servicePrefix string, ext ExtIOFunc) loadR
 		if err != nil {
 			return loadResult{nil, err}
 		}
+		setSource(vars, "keychain", namespace)
 		envvars = append(envvars, vars...)
 	}
 
 	return loadResult{envvars, nil}
 }
 
-func loadStdin(stdinFmt string, ext ExtIOFunc) loadResult {
+func loadStdin(stdinFmt string, opts structOptions, ext ExtIOFunc) loadResult {
 	var envvars []*envvar
 
 	parser := func(io.Reader) ([]*envvar, error) { return nil, nil }
 
 	switch stdinFmt {
 	case "json":
-		parser = parseJSONFile
+		parser = func(fd io.Reader) ([]*envvar, error) { return parseJSONFile(fd, "", opts) }
+	case "yaml":
+		parser = func(fd io.Reader) ([]*envvar, error) { return parseYAMLFile(fd, "", opts) }
+	case "toml":
+		parser = func(fd io.Reader) ([]*envvar, error) { return parseTOMLFile(fd, "", opts) }
 	case "env":
 		parser = parseEnvFile
 	case "aws-assume-role":
@@ -169,19 +321,50 @@ func loadStdin(stdinFmt string, ext ExtIOFunc) loadResult {
 	if err != nil {
 		return loadResult{nil, errors.Wrap(err, "Fail to parse data from stdin")}
 	}
+	setSource(vars, "stdin", "")
 	envvars = append(envvars, vars...)
 
 	return loadResult{envvars, nil}
 }
 
+// onceInput is stdin data and prompt value read only once. They are replayed
+// when variables are resolved more than once, e.g. both sides of diff.
+type onceInput struct {
+	stdin  []byte
+	prompt string
+}
+
+func readOnceInput(params parameters) (*onceInput, error) {
+	input := &onceInput{}
+	if params.Stdin != "" {
+		raw, err := ioutil.ReadAll(params.ExtIO.Stdin)
+		if err != nil {
+			return nil, errors.Wrap(err, "Fail to read stdin")
+		}
+		input.stdin = raw
+	}
+	if params.Prompt != "" {
+		input.prompt = params.ExtIO.InputFunc(fmt.Sprintf("Enter %s value", params.Prompt))
+	}
+	return input, nil
+}
+
+// replay returns ext whose Stdin and InputFunc return the input read once.
+func (x *onceInput) replay(ext ExtIOFunc) ExtIOFunc {
+	ext.Stdin = bytes.NewReader(x.stdin)
+	ext.InputFunc = func(string) string { return x.prompt }
+	return ext
+}
+
 func loadPrompt(prompt string, ext ExtIOFunc) loadResult {
 	var envvars []*envvar
 
 	if prompt != "" {
 		value := ext.InputFunc(fmt.Sprintf("Enter %s value", prompt))
 		envvars = append(envvars, &envvar{
-			Key:   prompt,
-			Value: value,
+			Key:    prompt,
+			Value:  value,
+			Source: varSource{Type: "prompt"},
 		})
 	}
 
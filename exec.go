@@ -2,14 +2,78 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
-	"syscall"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-func execCommand(vars []*envvar, args []string) error {
+// splitEnviron converts "KEY=VALUE" style environment to map.
+func splitEnviron(environ []string) map[string]string {
+	envmap := map[string]string{}
+	for _, env := range environ {
+		pos := strings.Index(env, "=")
+		if pos < 0 {
+			continue
+		}
+		envmap[env[:pos]] = env[pos+1:]
+	}
+	return envmap
+}
+
+// applyHostEnv checks collisions between loaded variables and inherited
+// environment variables, and returns variables that should be set by policy.
+func applyHostEnv(vars []*envvar, host []string, policy hostEnvPolicy) ([]*envvar, error) {
+	hostmap := splitEnviron(host)
+
+	var newVars []*envvar
+	for _, v := range vars {
+		if _, ok := hostmap[v.Key]; !ok {
+			newVars = append(newVars, v)
+			continue
+		}
+
+		switch policy {
+		case hostEnvDeny:
+			return nil, fmt.Errorf("Deny to overwrite inherited environment variable `%s`", v.Key)
+		case hostEnvKeep:
+			logger.WithField("key", v.Key).Warn("Kept inherited environment variable, ignored loaded value")
+		case hostEnvReplace:
+			logger.WithField("key", v.Key).Debug("Replaced inherited environment variable")
+			newVars = append(newVars, v)
+		}
+	}
+
+	return newVars, nil
+}
+
+// buildEnviron merges inherited environment and loaded variables without
+// duplicated keys. Loaded variables take priority.
+func buildEnviron(vars []*envvar, host []string) []string {
+	varmap := map[string]bool{}
+	for _, v := range vars {
+		varmap[v.Key] = true
+	}
+
+	var envvars []string
+	for _, env := range host {
+		pos := strings.Index(env, "=")
+		if pos >= 0 && varmap[env[:pos]] {
+			continue
+		}
+		envvars = append(envvars, env)
+	}
+
+	for _, v := range vars {
+		envvars = append(envvars, fmt.Sprintf("%s=%s", v.Key, v.Value))
+	}
+
+	return envvars
+}
+
+// execCommand replaces current process with the command. The command runs as
+// child process of altenv in supervise mode.
+func execCommand(vars []*envvar, args []string, config altenvConfig, ext ExtIOFunc) error {
 	if len(args) == 0 {
 		return fmt.Errorf("No arguments")
 	}
@@ -19,14 +83,69 @@ func execCommand(vars []*envvar, args []string) error {
 		return err
 	}
 
-	envvars := os.Environ()
-	for _, v := range vars {
-		envvars = append(envvars, fmt.Sprintf("%s=%s", v.Key, v.Value))
+	vars, err = runPreHooks(vars, config, ext)
+	if err != nil {
+		return err
+	}
+
+	if config.supervise {
+		return superviseCommand(newSupervisor(ext), vars, binary, args, config, ext)
 	}
 
-	if err := syscall.Exec(binary, args, envvars); err != nil {
+	envvars := buildEnviron(vars, ext.environ())
+	if err := ext.exec(binary, args, envvars); err != nil {
 		return errors.Wrapf(err, "Fail to exec: %v", args)
 	}
 
 	return nil
 }
+
+// superviseCommand runs the command as child process by sv. Temp files of
+// `file` config are removed after exit of the command.
+func superviseCommand(sv *supervisor, vars []*envvar, binary string, args []string, config altenvConfig, ext ExtIOFunc) error {
+	if len(config.TempFiles) > 0 {
+		files, fileVars, err := writeTempFiles(config.TempFiles, vars, ext)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := files.cleanup(); err != nil {
+				logger.WithError(err).Warn("Fail to remove temp files")
+			}
+		}()
+		fileVars, err = applyHostEnv(fileVars, ext.environ(), config.hostEnv)
+		if err != nil {
+			return err
+		}
+		vars = append(vars, fileVars...)
+	}
+
+	envvars := buildEnviron(vars, ext.environ())
+
+	var flushRedacted postExitFunc
+	if config.redact {
+		secrets := secretValues(vars, config.Secrets)
+		stdout, stderr := newRedactor(ext.Stdout, secrets), newRedactor(ext.Stderr, secrets)
+		sv.ext.Stdout, sv.ext.Stderr = stdout, stderr
+		flushRedacted = func(exitResult) error {
+			if err := stdout.Close(); err != nil {
+				return errors.Wrap(err, "Fail to write redacted stdout")
+			}
+			if err := stderr.Close(); err != nil {
+				return errors.Wrap(err, "Fail to write redacted stderr")
+			}
+			return nil
+		}
+	}
+	// Post hooks run before flush of redactors because their output is also
+	// redacted
+	if len(config.PostHooks) > 0 {
+		sv.addPostExit(postHooks(envvars, config, sv.ext))
+	}
+	if flushRedacted != nil {
+		sv.addPostExit(flushRedacted)
+	}
+	sv.addPostExit(logExitResult)
+
+	return sv.run(binary, args, envvars)
+}
@@ -0,0 +1,15 @@
+package main_test
+
+import (
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildEnvironNoDuplicatedKey(t *testing.T) {
+	host := []string{"COLOR=RED", "HOME=/home/blue", "PATH=/bin"}
+	envs := BuildEnviron(map[string]string{"COLOR": "BLUE"}, host)
+
+	assert.ElementsMatch(t, []string{"HOME=/home/blue", "PATH=/bin", "COLOR=BLUE"}, envs)
+}
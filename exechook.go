@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// exitCodeKey has exit status of the command in post hooks.
+const exitCodeKey = "ALTENV_EXIT_CODE"
+
+// runHookCommand runs a hook command by /bin/sh with env.
+func runHookCommand(command string, env []string, stdout, stderr io.Writer, ext ExtIOFunc) error {
+	if err := ext.shell(command, env, stdout, stderr); err != nil {
+		return errors.Wrapf(err, "Fail to run hook `%s`", command)
+	}
+	return nil
+}
+
+// handleHookError returns err if policy is abort. Otherwise, err is logged.
+func handleHookError(err error, policy hookPolicy) error {
+	switch policy {
+	case hookWarn:
+		logger.WithError(err).Warn("Hook failed, continue")
+	case hookIgnore:
+		logger.WithError(err).Debug("Hook failed, ignored")
+	default:
+		return err
+	}
+	return nil
+}
+
+// parseHookOutput parses output of pre hook as JSON object if it starts with
+// `{`, otherwise as EnvVar file.
+func parseHookOutput(out []byte) ([]*envvar, error) {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, nil
+	}
+	if out[0] != '{' {
+		return parseEnvFile(bytes.NewReader(out))
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(out, &obj); err != nil {
+		return nil, errors.Wrap(err, "Fail to parse JSON output")
+	}
+
+	var keys []string
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var vars []*envvar
+	for _, key := range keys {
+		v := &envvar{Key: key}
+		switch value := obj[key].(type) {
+		case string:
+			v.Value = value
+		case nil:
+		case float64, bool:
+			raw, _ := json.Marshal(value)
+			v.Value = string(raw)
+		default:
+			return nil, fmt.Errorf("Value of `%s` in JSON output must be string, number or bool", key)
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// runPreHooks runs pre hooks with the resolved environment in order. Variables
+// output by a hook are added to vars (and replace the same key) by hostenv
+// policy, then they are available in following hooks and the command.
+func runPreHooks(vars []*envvar, config altenvConfig, ext ExtIOFunc) ([]*envvar, error) {
+	for _, command := range config.PreHooks {
+		env := buildEnviron(vars, ext.environ())
+
+		var stdout bytes.Buffer
+		logger.WithField("command", command).Debug("Run pre hook")
+		if err := runHookCommand(command, env, &stdout, ext.Stderr, ext); err != nil {
+			if err := handleHookError(err, config.hook); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		output, err := parseHookOutput(stdout.Bytes())
+		if err != nil {
+			err = errors.Wrapf(err, "Fail to parse output of hook `%s`", command)
+			if err := handleHookError(err, config.hook); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Output of hook is also a loaded variable for inherited environment
+		output, err = applyHostEnv(output, ext.environ(), config.hostEnv)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Fail to set output of hook `%s`", command)
+		}
+
+		for _, v := range output {
+			logger.WithFields(logrus.Fields{"key": v.Key, "hook": command}).Debug("Set variable by pre hook")
+			v.Source = varSource{Type: "pre", Path: command}
+			vars = replaceEnvVar(vars, v)
+		}
+	}
+
+	return vars, nil
+}
+
+func replaceEnvVar(vars []*envvar, v *envvar) []*envvar {
+	for i := range vars {
+		if vars[i].Key == v.Key {
+			newVars := append([]*envvar{}, vars[:i]...)
+			newVars = append(newVars, vars[i+1:]...)
+			return append(newVars, v)
+		}
+	}
+	return append(vars, v)
+}
+
+// postHooks returns post-exit function that runs post hooks with exit status
+// of the command in ALTENV_EXIT_CODE. Output of hooks is written to Stdout and
+// Stderr of ext.
+func postHooks(env []string, config altenvConfig, ext ExtIOFunc) postExitFunc {
+	return func(result exitResult) error {
+		hookEnv := append(append([]string{}, env...), exitCodeKey+"="+strconv.Itoa(result.code))
+		for _, command := range config.PostHooks {
+			logger.WithField("command", command).Debug("Run post hook")
+			if err := runHookCommand(command, hookEnv, ext.Stdout, ext.Stderr, ext); err != nil {
+				if err := handleHookError(err, config.hook); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
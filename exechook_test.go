@@ -0,0 +1,166 @@
+package main_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runExecHookTest(config string, args ...string) (*execCall, string, error) {
+	var call *execCall
+	stdout := &notifyWriter{}
+	params := newTestParams(&bytes.Buffer{}, map[string]string{"/conf/altenv.toml": config}, "/some/where", "PATH=/bin:/usr/bin")
+	params.ExtIO.Stdout = stdout
+	params.ExtIO.Exec = func(binary string, args []string, env []string) error {
+		call = &execCall{binary: binary, args: args, env: SplitEnviron(env)}
+		return nil
+	}
+
+	err := NewApp(params).Run(append([]string{"altenv", "-c", "/conf/altenv.toml"}, args...))
+	return call, stdout.String(), err
+}
+
+func TestPreHooks(t *testing.T) {
+	call, _, err := runExecHookTest(`
+[global]
+define = ["REGION=us-east-1", "TOKEN=old"]
+pre = [
+  "echo TOKEN=refreshed-$REGION",
+  "echo '{\"EXPIRES_IN\": 3600, \"SESSION\": \"'$TOKEN'\"}'",
+  "echo progress >&2",
+]
+`, "/bin/sh", "-c", "true")
+	require.NoError(t, err)
+	require.NotNil(t, call)
+	assert.Equal(t, "refreshed-us-east-1", call.env["TOKEN"])
+	assert.Equal(t, "3600", call.env["EXPIRES_IN"])
+	assert.Equal(t, "refreshed-us-east-1", call.env["SESSION"])
+}
+
+func TestPreHookPolicy(t *testing.T) {
+	config := `
+[global]
+pre = ["echo FIRST=1; exit 1", "echo SECOND=2"]
+`
+	call, _, err := runExecHookTest(config, "/bin/sh", "-c", "true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fail to run hook `echo FIRST=1; exit 1`")
+	assert.Nil(t, call)
+
+	call, _, err = runExecHookTest(config+`hookPolicy = "warn"`, "/bin/sh", "-c", "true")
+	require.NoError(t, err)
+	require.NotNil(t, call)
+	assert.Equal(t, "", call.env["FIRST"])
+	assert.Equal(t, "2", call.env["SECOND"])
+
+	_, _, err = runExecHookTest(`
+[global]
+pre = ["echo '{\"NESTED\": {\"A\": 1}}'"]
+`, "/bin/sh", "-c", "true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Value of `NESTED` in JSON output must be string, number or bool")
+}
+
+func TestPostHooks(t *testing.T) {
+	call, out, err := runExecHookTest(`
+[global]
+define = ["COLOR=blue"]
+post = ["echo post $COLOR $ALTENV_EXIT_CODE"]
+`, "/bin/sh", "-c", "echo main; exit 4")
+	assert.Nil(t, call, "post hooks enable supervise mode")
+	require.Error(t, err)
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	assert.Equal(t, 4, code)
+	assert.Equal(t, "main\npost blue 4\n", out)
+}
+
+func TestPostHookPolicy(t *testing.T) {
+	config := `
+[global]
+post = ["exit 1", "echo done"]
+`
+	_, out, err := runExecHookTest(config, "/bin/sh", "-c", "true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fail to run hook `exit 1`")
+	assert.Equal(t, "", out)
+
+	_, out, err = runExecHookTest(config+`hookPolicy = "ignore"`, "/bin/sh", "-c", "true")
+	require.NoError(t, err)
+	assert.Equal(t, "done\n", out)
+
+	_, _, err = runExecHookTest(`
+[global]
+hookPolicy = "retry"
+`, "/bin/sh", "-c", "true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "`retry` is not valid hookPolicy option, must be [abort|warn|ignore]")
+}
+
+func runPreHookShellTest(config string, outputs map[string]string) (*execCall, []string, error) {
+	var call *execCall
+	var commands []string
+	params := newTestParams(&bytes.Buffer{}, map[string]string{"/conf/altenv.toml": config}, "/some/where",
+		"PATH=/bin:/usr/bin", "TOKEN=inherited")
+	params.ExtIO.Shell = func(command string, env []string, stdout, stderr io.Writer) error {
+		commands = append(commands, command)
+		_, err := io.WriteString(stdout, outputs[command])
+		return err
+	}
+	params.ExtIO.Exec = func(binary string, args []string, env []string) error {
+		call = &execCall{binary: binary, args: args, env: SplitEnviron(env)}
+		return nil
+	}
+
+	err := NewApp(params).Run([]string{"altenv", "-c", "/conf/altenv.toml", "/bin/sh", "-c", "true"})
+	return call, commands, err
+}
+
+func TestPreHookShellFunc(t *testing.T) {
+	call, commands, err := runPreHookShellTest(`
+[global]
+pre = ["get-session", "get-region"]
+`, map[string]string{
+		"get-session": "SESSION=abc",
+		"get-region":  `{"REGION": "us-east-1"}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"get-session", "get-region"}, commands)
+	require.NotNil(t, call)
+	assert.Equal(t, "abc", call.env["SESSION"])
+	assert.Equal(t, "us-east-1", call.env["REGION"])
+}
+
+func TestPreHookHostEnv(t *testing.T) {
+	outputs := map[string]string{"refresh": "TOKEN=refreshed"}
+
+	call, _, err := runPreHookShellTest(`
+[global]
+pre = ["refresh"]
+`, outputs)
+	require.NoError(t, err)
+	require.NotNil(t, call)
+	assert.Equal(t, "refreshed", call.env["TOKEN"])
+
+	call, _, err = runPreHookShellTest(`
+[global]
+pre = ["refresh"]
+hostenv = "keep"
+`, outputs)
+	require.NoError(t, err)
+	require.NotNil(t, call)
+	assert.Equal(t, "inherited", call.env["TOKEN"])
+
+	call, _, err = runPreHookShellTest(`
+[global]
+pre = ["refresh"]
+hostenv = "deny"
+`, outputs)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Deny to overwrite inherited environment variable `TOKEN`")
+	assert.Nil(t, call)
+}
@@ -11,7 +11,9 @@ import (
 
 var (
 	ReadEnvFile  = readEnvFile
-	ReadJSONFile = readJSONFile
+	ReadJSONFile = func(fpath string, open fileOpen) ([]*envvar, error) {
+		return readJSONFile(fpath, structOptions{}, open)
+	}
 )
 
 type Parameters parameters
@@ -25,7 +27,27 @@ func Run(params Parameters, args []string) error {
 	return run((parameters)(params), args)
 }
 
+func BuildEnviron(vars map[string]string, host []string) []string {
+	var envvars []*envvar
+	for k, v := range vars {
+		envvars = append(envvars, &envvar{Key: k, Value: v})
+	}
+	return buildEnviron(envvars, host)
+}
+
 // Utilities
 func ToReadCloser(s string) io.ReadCloser {
 	return ioutil.NopCloser(strings.NewReader(s))
 }
+
+func SplitEnviron(environ []string) map[string]string {
+	return splitEnviron(environ)
+}
+
+func ExitStatus(err error) (int, bool) {
+	return exitStatus(err)
+}
+
+func NewRedactor(w io.Writer, secrets []string) io.WriteCloser {
+	return newRedactor(w, secrets)
+}
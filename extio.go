@@ -2,22 +2,46 @@ package main
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
 
 	"github.com/Songmu/prompter"
 )
 
-type fileOpen func(string) (io.ReadCloser, error) // based on os.Open
-type promptInput func(string) string              // based on prompter.Password
-type getWD func() (string, error)                 // based on os.Getwd
+type fileOpen func(string) (io.ReadCloser, error)                 // based on os.Open
+type fileCreate func(string) (io.WriteCloser, error)              // based on os.Create
+type promptInput func(string) string                              // based on prompter.Password
+type getWD func() (string, error)                                 // based on os.Getwd
+type environ func() []string                                      // based on os.Environ
+type getHostname func() (string, error)                           // based on os.Hostname
+type globFunc func(string) ([]string, error)                      // based on filepath.Glob
+type evalSymlinks func(string) (string, error)                    // based on filepath.EvalSymlinks
+type execFunc func(string, []string, []string) error              // based on syscall.Exec
+type tempDirFunc func(string, string) (string, error)             // based on ioutil.TempDir
+type removeAllFunc func(string) error                             // based on os.RemoveAll
+type shellFunc func(string, []string, io.Writer, io.Writer) error // based on exec.Command("/bin/sh", "-c", ...)
 
 // ExtIOFunc is external IO function set.
 type ExtIOFunc struct {
 	DryRunOutput       io.Writer
 	Stdin              io.Reader
+	Stdout             io.Writer
+	Stderr             io.Writer
 	OpenFunc           fileOpen
+	CreateFunc         fileCreate
 	InputFunc          promptInput
 	Getwd              getWD
+	Environ            environ
+	Hostname           getHostname
+	Glob               globFunc
+	EvalSymlinks       evalSymlinks
+	Exec               execFunc
+	TempDir            tempDirFunc
+	RemoveAll          removeAllFunc
+	Shell              shellFunc
 	KeychainAddItem    keychainAddItem
 	KeychainUpdateItem keychainUpdateItem
 	KeychainQueryItem  keychainQueryItem
@@ -28,10 +52,128 @@ func NewExtIOFunc() *ExtIOFunc {
 	extIO := &ExtIOFunc{
 		DryRunOutput: os.Stdout,
 		Stdin:        os.Stdin,
+		Stdout:       os.Stdout,
+		Stderr:       os.Stderr,
 		OpenFunc:     wrapOSOpen,
+		CreateFunc:   wrapOSCreate,
 		InputFunc:    prompter.Password,
 		Getwd:        os.Getwd,
+		Environ:      os.Environ,
+		Hostname:     os.Hostname,
+		Glob:         filepath.Glob,
+		EvalSymlinks: filepath.EvalSymlinks,
+		Exec:         syscall.Exec,
+		TempDir:      ioutil.TempDir,
+		RemoveAll:    os.RemoveAll,
+		Shell:        runShell,
 	}
 	setupKeychainFunc(extIO)
 	return extIO
 }
+
+// environ returns inherited environment variables. Empty if Environ is not set.
+func (x ExtIOFunc) environ() []string {
+	if x.Environ == nil {
+		return nil
+	}
+	return x.Environ()
+}
+
+// getenv returns a value of inherited environment variable. os.Getenv is
+// used if Environ is not set.
+func (x ExtIOFunc) getenv(key string) string {
+	if x.Environ == nil {
+		return os.Getenv(key)
+	}
+	return splitEnviron(x.Environ())[key]
+}
+
+// lookupEnv is same as getenv, but it also returns if the variable is set.
+func (x ExtIOFunc) lookupEnv(key string) (string, bool) {
+	if x.Environ == nil {
+		return os.LookupEnv(key)
+	}
+	value, ok := splitEnviron(x.Environ())[key]
+	return value, ok
+}
+
+// hostname returns host name. os.Hostname is used if Hostname is not set.
+func (x ExtIOFunc) hostname() (string, error) {
+	if x.Hostname == nil {
+		return os.Hostname()
+	}
+	return x.Hostname()
+}
+
+// glob returns sorted file paths matched with pattern. Pattern is returned as
+// it is if it has no glob meta character. filepath.Glob is used if Glob is not
+// set.
+func (x ExtIOFunc) glob(pattern string) ([]string, error) {
+	glob := x.Glob
+	if glob == nil {
+		glob = filepath.Glob
+	}
+	return sortedGlob(pattern, glob)
+}
+
+// evalSymlinks returns path with resolved symbolic links. path is returned as
+// it is if EvalSymlinks is not set.
+func (x ExtIOFunc) evalSymlinks(path string) (string, error) {
+	if x.EvalSymlinks == nil {
+		return path, nil
+	}
+	return x.EvalSymlinks(path)
+}
+
+// exec replaces current process with binary. syscall.Exec is used if Exec is
+// not set.
+func (x ExtIOFunc) exec(binary string, args []string, env []string) error {
+	if x.Exec == nil {
+		return syscall.Exec(binary, args, env)
+	}
+	return x.Exec(binary, args, env)
+}
+
+// create creates a file to write. wrapOSCreate is used if CreateFunc is not
+// set.
+func (x ExtIOFunc) create(path string) (io.WriteCloser, error) {
+	if x.CreateFunc == nil {
+		return wrapOSCreate(path)
+	}
+	return x.CreateFunc(path)
+}
+
+// tempDir creates a new temp directory that only owner can access.
+// ioutil.TempDir is used if TempDir is not set.
+func (x ExtIOFunc) tempDir(dir, pattern string) (string, error) {
+	if x.TempDir == nil {
+		return ioutil.TempDir(dir, pattern)
+	}
+	return x.TempDir(dir, pattern)
+}
+
+// removeAll removes path and any children it contains. os.RemoveAll is used
+// if RemoveAll is not set.
+func (x ExtIOFunc) removeAll(path string) error {
+	if x.RemoveAll == nil {
+		return os.RemoveAll(path)
+	}
+	return x.RemoveAll(path)
+}
+
+// runShell runs command by /bin/sh with env and waits for exit of it.
+func runShell(command string, env []string, stdout, stderr io.Writer) error {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = env
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// shell runs command by /bin/sh. runShell is used if Shell is not set.
+func (x ExtIOFunc) shell(command string, env []string, stdout, stderr io.Writer) error {
+	if x.Shell == nil {
+		return runShell(command, env, stdout, stderr)
+	}
+	return x.Shell(command, env, stdout, stderr)
+}
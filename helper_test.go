@@ -0,0 +1,63 @@
+package main_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	. "github.com/m-mizutani/altenv"
+)
+
+// memFile is in-memory file that is stored to files when closed.
+type memFile struct {
+	bytes.Buffer
+	name  string
+	files map[string]string
+}
+
+func (x *memFile) Close() error {
+	x.files[x.name] = x.String()
+	return nil
+}
+
+// testFiles is in-memory file system for tests. Key is path of the file and
+// value is the content.
+type testFiles map[string]string
+
+func (x testFiles) open(fname string) (io.ReadCloser, error) {
+	if data, ok := x[fname]; ok {
+		return ToReadCloser(data), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (x testFiles) create(fname string) (io.WriteCloser, error) {
+	return &memFile{name: fname, files: x}, nil
+}
+
+func (x testFiles) glob(pattern string) ([]string, error) {
+	var matches []string
+	for fname := range x {
+		if ok, _ := filepath.Match(pattern, fname); ok {
+			matches = append(matches, fname)
+		}
+	}
+	return matches, nil
+}
+
+// newTestParams returns parameters whose ExtIO reads files from files, and
+// matches glob patterns with paths in files. environ is inherited
+// environment variables. Other functions can be set by each test.
+func newTestParams(buf *bytes.Buffer, files map[string]string, cwd string, environ ...string) *Parameters {
+	fs := testFiles(files)
+	return &Parameters{
+		ExtIO: &ExtIOFunc{
+			DryRunOutput: buf,
+			Environ:      func() []string { return environ },
+			Getwd:        func() (string, error) { return cwd, nil },
+			OpenFunc:     fs.open,
+			Glob:         fs.glob,
+		},
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// hookStateKey is environment variable that has state of shell hook.
+const hookStateKey = "ALTENV_STATE"
+
+// hookState is state of variables exported by shell hook.
+type hookState struct {
+	Dir         string `json:"dir"`
+	Fingerprint string `json:"fingerprint"`
+	// Files are all files read to build variables, including files that do
+	// not exist, e.g. candidates of project config file.
+	Files []string `json:"files"`
+	// Prev is values before exported by the hook. nil means unset.
+	Prev map[string]*string `json:"prev"`
+}
+
+func decodeHookState(encoded string) hookState {
+	var state hookState
+	if encoded == "" {
+		return state
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(raw, &state)
+	}
+	if err != nil {
+		logger.WithError(err).Warn("Fail to decode state of shell hook, discard it")
+		return hookState{}
+	}
+	return state
+}
+
+func (x hookState) encode() (string, error) {
+	raw, err := json.Marshal(x)
+	if err != nil {
+		return "", errors.Wrap(err, "Fail to encode state of shell hook")
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// openRecorder records paths opened by OpenFunc.
+type openRecorder struct {
+	open  fileOpen
+	paths map[string]bool
+}
+
+func newOpenRecorder(open fileOpen) *openRecorder {
+	return &openRecorder{open: open, paths: map[string]bool{}}
+}
+
+func (x *openRecorder) Open(path string) (io.ReadCloser, error) {
+	x.paths[path] = true
+	return x.open(path)
+}
+
+func (x *openRecorder) files() []string {
+	var files []string
+	for path := range x.paths {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// filesFingerprint returns hash of content of files. Missing file and
+// directory are also distinguished.
+func filesFingerprint(files []string, open fileOpen) string {
+	hash := sha256.New()
+	for _, path := range files {
+		digest := "-"
+		if fd, err := open(path); err == nil {
+			if raw, err := ioutil.ReadAll(fd); err == nil {
+				digest = contentHash(raw)
+			} else {
+				digest = "unreadable"
+			}
+			fd.Close()
+		}
+		fmt.Fprintf(hash, "%s\x00%s\n", path, digest)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+var shellVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type shellSyntax struct {
+	set   func(key, value string) string
+	unset func(key string) string
+	hook  string
+}
+
+func posixQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+var posixShellSyntax = shellSyntax{
+	set:   func(key, value string) string { return fmt.Sprintf("export %s=%s;", key, posixQuote(value)) },
+	unset: func(key string) string { return fmt.Sprintf("unset %s;", key) },
+}
+
+var shellSyntaxes = map[string]shellSyntax{
+	"bash": {
+		set:   posixShellSyntax.set,
+		unset: posixShellSyntax.unset,
+		hook: `_altenv_hook() {
+  local previous_exit_status=$?
+  eval "$(%[1]s -r export bash)"
+  return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND[*]:-};" != *";_altenv_hook;"* ]]; then
+  PROMPT_COMMAND="_altenv_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	},
+	"zsh": {
+		set:   posixShellSyntax.set,
+		unset: posixShellSyntax.unset,
+		hook: `_altenv_hook() {
+  eval "$(%[1]s -r export zsh)"
+}
+typeset -ag precmd_functions chpwd_functions
+if (( ! ${precmd_functions[(I)_altenv_hook]} )); then
+  precmd_functions=(_altenv_hook $precmd_functions)
+fi
+if (( ! ${chpwd_functions[(I)_altenv_hook]} )); then
+  chpwd_functions=(_altenv_hook $chpwd_functions)
+fi
+`,
+	},
+	"fish": {
+		set:   func(key, value string) string { return fmt.Sprintf("set -gx %s %s;", key, fishQuote(value)) },
+		unset: func(key string) string { return fmt.Sprintf("set -e %s;", key) },
+		hook: `function __altenv_hook --on-event fish_prompt --on-variable PWD
+    %[1]s -r export fish | source
+end
+`,
+	},
+}
+
+func lookupShell(args []string) (shellSyntax, error) {
+	if len(args) != 1 {
+		return shellSyntax{}, fmt.Errorf("Shell name is required, e.g. `altenv -r hook bash` [bash|zsh|fish]")
+	}
+	syntax, ok := shellSyntaxes[args[0]]
+	if !ok {
+		return shellSyntax{}, fmt.Errorf("Unsupported shell `%s`, must be [bash|zsh|fish]", args[0])
+	}
+	return syntax, nil
+}
+
+// printShellHook outputs hook script that exports variables for CWD on
+// every prompt. -c and -p options are passed to the hook.
+func printShellHook(params parameters, args []string) error {
+	syntax, err := lookupShell(args)
+	if err != nil {
+		return err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		self = "altenv"
+	}
+	command := []string{posixQuote(self)}
+	if params.ConfigPath != defaultConfigPath {
+		command = append(command, "-c", posixQuote(params.ConfigPath))
+	}
+	if params.Profile != defaultProfileName {
+		command = append(command, "-p", posixQuote(params.Profile))
+	}
+
+	if _, err := fmt.Fprintf(params.ExtIO.DryRunOutput, syntax.hook, strings.Join(command, " ")); err != nil {
+		return errors.Wrap(err, "Fail to output shell hook")
+	}
+	return nil
+}
+
+// exportShellEnv outputs shell statements to export variables for CWD and to
+// restore variables exported for previous directory. Nothing is output if
+// CWD and all files read for previous result are not changed.
+func exportShellEnv(params parameters, args []string) error {
+	syntax, err := lookupShell(args)
+	if err != nil {
+		return err
+	}
+
+	ext := *params.ExtIO
+	host := splitEnviron(ext.environ())
+	cwd, err := ext.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "Fail to get CWD")
+	}
+
+	state := decodeHookState(host[hookStateKey])
+	if state.Dir == cwd && state.Fingerprint == filesFingerprint(state.Files, ext.OpenFunc) {
+		logger.WithField("dir", cwd).Debug("Shell hook state is up to date")
+		return nil
+	}
+
+	recorder := newOpenRecorder(ext.OpenFunc)
+	ext.OpenFunc = recorder.Open
+
+	config, err := setupConfig(params, nil, ext)
+	if err != nil {
+		return err
+	}
+	envvars, err := loadEnvVars(*config, ext)
+	if err != nil {
+		return err
+	}
+
+	vars := map[string]string{}
+	for _, v := range envvars {
+		if !shellVarName.MatchString(v.Key) {
+			logger.WithField("key", v.Key).Warn("Skip variable that can not be exported by shell")
+			continue
+		}
+		vars[v.Key] = v.Value
+	}
+
+	// nil value means unset
+	changes := map[string]*string{}
+	prev := map[string]*string{}
+	for key, value := range state.Prev {
+		if _, ok := vars[key]; ok {
+			prev[key] = value
+		} else {
+			changes[key] = value
+		}
+	}
+	for key, value := range vars {
+		current, ok := host[key]
+		if _, applied := state.Prev[key]; !applied {
+			if ok {
+				prev[key] = &current
+			} else {
+				prev[key] = nil
+			}
+		}
+		if !ok || current != value {
+			v := value
+			changes[key] = &v
+		}
+	}
+
+	newState := hookState{
+		Dir:   cwd,
+		Files: recorder.files(),
+		Prev:  prev,
+	}
+	newState.Fingerprint = filesFingerprint(newState.Files, recorder.open)
+	encoded, err := newState.encode()
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, key := range keys {
+		if changes[key] == nil {
+			lines = append(lines, syntax.unset(key))
+		} else {
+			lines = append(lines, syntax.set(key, *changes[key]))
+		}
+	}
+	lines = append(lines, syntax.set(hookStateKey, encoded))
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(ext.DryRunOutput, line); err != nil {
+			return errors.Wrap(err, "Fail to output shell statements")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hookTestConfig = `
+[workdir.proj1]
+dirpath = "/work/proj1"
+envfile = ["/conf/proj1.env"]
+`
+
+type hookTestEnv struct {
+	cwd     string
+	environ []string
+	files   map[string]string
+}
+
+func runHookTest(env hookTestEnv, args ...string) (string, error) {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, env.files, env.cwd, env.environ...)
+	err := NewApp(params).Run(append([]string{"altenv"}, args...))
+	return buf.String(), err
+}
+
+// splitHookOutput returns statements except state and the state value.
+func splitHookOutput(out string) ([]string, string) {
+	var lines []string
+	var state string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.HasPrefix(line, "export ALTENV_STATE=") {
+			state = strings.TrimSuffix(strings.TrimPrefix(line, "export ALTENV_STATE='"), "';")
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, state
+}
+
+func newHookTestFiles() map[string]string {
+	return map[string]string{
+		"/conf/altenv.toml": hookTestConfig,
+		"/conf/proj1.env":   "COLOR=blue\nQUOTE=it's",
+	}
+}
+
+func TestHookScript(t *testing.T) {
+	out, err := runHookTest(hookTestEnv{cwd: "/"}, "-r", "hook", "-c", "/conf/altenv.toml", "-p", "dev", "bash")
+	require.NoError(t, err)
+	assert.Contains(t, out, "-c '/conf/altenv.toml' -p 'dev' -r export bash")
+	assert.Contains(t, out, "PROMPT_COMMAND=")
+
+	out, err = runHookTest(hookTestEnv{cwd: "/"}, "-r", "hook", "fish")
+	require.NoError(t, err)
+	assert.Contains(t, out, "-r export fish | source")
+}
+
+func TestHookUnsupportedShell(t *testing.T) {
+	_, err := runHookTest(hookTestEnv{cwd: "/"}, "-r", "hook", "tcsh")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unsupported shell `tcsh`")
+}
+
+func TestHookExportAndRestore(t *testing.T) {
+	files := newHookTestFiles()
+
+	// Enter the directory
+	out, err := runHookTest(hookTestEnv{
+		cwd:     "/work/proj1/src",
+		environ: []string{"COLOR=red"},
+		files:   files,
+	}, "-c", "/conf/altenv.toml", "-r", "export", "bash")
+	require.NoError(t, err)
+	lines, state := splitHookOutput(out)
+	assert.Equal(t, []string{
+		"export COLOR='blue';",
+		`export QUOTE='it'\''s';`,
+	}, lines)
+	require.NotEmpty(t, state)
+
+	// Nothing is changed
+	environ := []string{"COLOR=blue", "QUOTE=it's", "ALTENV_STATE=" + state}
+	out, err = runHookTest(hookTestEnv{
+		cwd:     "/work/proj1/src",
+		environ: environ,
+		files:   files,
+	}, "-c", "/conf/altenv.toml", "-r", "export", "bash")
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+
+	// Source file is changed
+	files["/conf/proj1.env"] = "COLOR=green"
+	out, err = runHookTest(hookTestEnv{
+		cwd:     "/work/proj1/src",
+		environ: environ,
+		files:   files,
+	}, "-c", "/conf/altenv.toml", "-r", "export", "bash")
+	require.NoError(t, err)
+	lines, state = splitHookOutput(out)
+	assert.Equal(t, []string{
+		"export COLOR='green';",
+		"unset QUOTE;",
+	}, lines)
+
+	// Leave the directory
+	out, err = runHookTest(hookTestEnv{
+		cwd:     "/work",
+		environ: []string{"COLOR=green", "ALTENV_STATE=" + state},
+		files:   files,
+	}, "-c", "/conf/altenv.toml", "-r", "export", "bash")
+	require.NoError(t, err)
+	lines, _ = splitHookOutput(out)
+	assert.Equal(t, []string{"export COLOR='red';"}, lines)
+}
+
+func TestHookExportFish(t *testing.T) {
+	out, err := runHookTest(hookTestEnv{
+		cwd:   "/work/proj1",
+		files: newHookTestFiles(),
+	}, "-c", "/conf/altenv.toml", "-r", "export", "fish")
+	require.NoError(t, err)
+	assert.Contains(t, out, "set -gx COLOR 'blue';\n")
+	assert.Contains(t, out, `set -gx QUOTE 'it\'s';`+"\n")
+	assert.Contains(t, out, "set -gx ALTENV_STATE '")
+}
@@ -1,37 +1,44 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 
 	"github.com/sirupsen/logrus"
 )
 
-func readJSONFile(fpath string, open fileOpen) ([]*envvar, error) {
+func readJSONFile(fpath string, opts structOptions, open fileOpen) ([]*envvar, error) {
+	fpath, query := splitPathQuery(fpath)
+
 	fd, err := open(fpath)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
 
-	return parseJSONFile(fd)
+	return parseJSONFile(fd, query, opts)
 }
 
-func parseJSONFile(fd io.Reader) ([]*envvar, error) {
-	var jdata map[string]string
+func parseJSONFile(fd io.Reader, query string, opts structOptions) ([]*envvar, error) {
+	jdata, err := decodeOrderedJSON(fd)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := json.NewDecoder(fd).Decode(&jdata); err != nil {
+	selected, err := selectPath(jdata, query)
+	if err != nil {
 		return nil, err
 	}
-	var envvars []*envvar
 
-	for key, value := range jdata {
-		envvars = append(envvars, &envvar{Key: key, Value: value})
+	envvars, err := structToEnvVars(selected, opts)
+	if err != nil {
+		return nil, err
+	}
 
+	for _, v := range envvars {
 		logger.WithFields(logrus.Fields{
 			"type":  "jsonfile",
-			"key":   key,
-			"value": value,
+			"key":   v.Key,
+			"value": v.Value,
 		}).Debug("Add a new variable")
 	}
 
@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"bytes"
 	"io"
 	"sort"
 	"testing"
@@ -48,3 +49,77 @@ func TestJSONFileError(t *testing.T) {
 	require.Error(t, err)
 	assert.Nil(t, envvars)
 }
+
+func newJSONTestParams(buf *bytes.Buffer) *Parameters {
+	data := `{
+		"environments": {
+			"dev": {
+				"db": {"host": "localhost", "port": 5432, "ssl": false},
+				"hosts": ["blue", "orange"],
+				"name": "dev"
+			}
+		}
+	}`
+
+	return newTestParams(buf, map[string]string{"config.json": data}, "/some/where")
+}
+
+func TestJSONFileNestedWithOptions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newJSONTestParams(buf))
+
+	err := app.Run(newArgs("-j", "config.json#.environments.dev", "--coerce", "--flatten", "--array-format", "join"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "localhost", envmap["db_host"])
+	assert.Equal(t, "5432", envmap["db_port"])
+	assert.Equal(t, "false", envmap["db_ssl"])
+	assert.Equal(t, "blue,orange", envmap["hosts"])
+	assert.Equal(t, "dev", envmap["name"])
+}
+
+func TestJSONFileNestedCustomSeparatorAndJSONArray(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newJSONTestParams(buf))
+
+	err := app.Run(newArgs("-j", "config.json", "--coerce", "--flatten", "--flatten-separator", "__", "--array-format", "json"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "5432", envmap["environments__dev__db__port"])
+	assert.Equal(t, `["blue","orange"]`, envmap["environments__dev__hosts"])
+}
+
+func TestJSONFileNestedWithoutOptions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newJSONTestParams(buf))
+
+	err := app.Run(newArgs("-j", "config.json#.environments.dev.db", "--flatten"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "coerce option is required")
+}
+
+func TestJSONFileKeepKeyOrder(t *testing.T) {
+	data := `{"Z": "1", "A": "2", "M": "3"}`
+	envvars, err := ReadJSONFile("mytest.json", func(string) (io.ReadCloser, error) {
+		return ToReadCloser(data), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(envvars))
+	assert.Equal(t, "Z", envvars[0].Key)
+	assert.Equal(t, "A", envvars[1].Key)
+	assert.Equal(t, "M", envvars[2].Key)
+}
+
+func TestJSONFileNullValue(t *testing.T) {
+	envvars, err := ReadJSONFile("mytest.json", func(string) (io.ReadCloser, error) {
+		return ToReadCloser(`{"A": "blue", "B": null}`), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(envvars))
+
+	sort.Slice(envvars, func(i, j int) bool {
+		return envvars[i].Key < envvars[j].Key
+	})
+	assert.Equal(t, "B", envvars[1].Key)
+	assert.Equal(t, "", envvars[1].Value)
+}
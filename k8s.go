@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type k8sMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type k8sManifest struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+	BinaryData map[string]string `yaml:"binaryData,omitempty"`
+}
+
+func readK8sFile(fpath string, open fileOpen) ([]*envvar, error) {
+	fd, err := open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseK8sFile(fd)
+}
+
+// parseK8sFile reads Secret and ConfigMap from (multi-document) manifest.
+// Other kinds of resources are ignored.
+func parseK8sFile(fd io.Reader) ([]*envvar, error) {
+	var envvars []*envvar
+
+	dec := yaml.NewDecoder(fd)
+	for {
+		var manifest k8sManifest
+		if err := dec.Decode(&manifest); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "Fail to parse Kubernetes manifest")
+		}
+
+		vars, err := k8sManifestToEnvVars(manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range vars {
+			logger.WithFields(logrus.Fields{
+				"type":  "k8sfile",
+				"kind":  manifest.Kind,
+				"name":  manifest.Metadata.Name,
+				"key":   v.Key,
+				"value": v.Value,
+			}).Debug("Add a new variable")
+		}
+		envvars = append(envvars, vars...)
+	}
+
+	return envvars, nil
+}
+
+func k8sManifestToEnvVars(manifest k8sManifest) ([]*envvar, error) {
+	values := map[string]string{}
+
+	switch manifest.Kind {
+	case "Secret":
+		for key, encoded := range manifest.Data {
+			raw, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Fail to decode `%s` in Secret %s", key, manifest.Metadata.Name)
+			}
+			values[key] = string(raw)
+		}
+		// stringData overwrites data as Kubernetes API does
+		for key, value := range manifest.StringData {
+			values[key] = value
+		}
+
+	case "ConfigMap":
+		for key, encoded := range manifest.BinaryData {
+			raw, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Fail to decode `%s` in ConfigMap %s", key, manifest.Metadata.Name)
+			}
+			values[key] = string(raw)
+		}
+		for key, value := range manifest.Data {
+			values[key] = value
+		}
+
+	default:
+		logger.WithField("kind", manifest.Kind).Debug("Skip Kubernetes resource")
+		return nil, nil
+	}
+
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var envvars []*envvar
+	for _, key := range keys {
+		envvars = append(envvars, &envvar{Key: key, Value: values[key], secret: manifest.Kind == "Secret"})
+	}
+	return envvars, nil
+}
+
+// dumpK8sManifest outputs variables as Secret or ConfigMap manifest.
+func dumpK8sManifest(w io.Writer, vars []*envvar, kind, name, namespace string) error {
+	manifest := k8sManifest{
+		APIVersion: "v1",
+		Kind:       kind,
+		Metadata: k8sMetadata{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: map[string]string{},
+	}
+
+	switch kind {
+	case "Secret":
+		manifest.Type = "Opaque"
+		for _, v := range vars {
+			manifest.Data[v.Key] = base64.StdEncoding.EncodeToString([]byte(v.Value))
+		}
+	case "ConfigMap":
+		for _, v := range vars {
+			manifest.Data[v.Key] = v.Value
+		}
+	default:
+		return fmt.Errorf("Unsupported Kubernetes resource kind: %s", kind)
+	}
+
+	raw, err := yaml.Marshal(manifest)
+	if err != nil {
+		return errors.Wrap(err, "Fail to encode Kubernetes manifest")
+	}
+	if _, err := w.Write(raw); err != nil {
+		return errors.Wrap(err, "Fail to output Kubernetes manifest")
+	}
+
+	return nil
+}
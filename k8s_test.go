@@ -0,0 +1,123 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newK8sTestParams(buf *bytes.Buffer) *Parameters {
+	invalidManifest := `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: my-secret
+data:
+  DB_PASS: Qk xVRQ==
+`
+	manifest := `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: my-secret2
+data:
+  API_KEY: T1JBTkdF
+  TOKEN: eHh4
+stringData:
+  TOKEN: TIMELESS
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-config
+data:
+  COLOR: blue
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+`
+	return newTestParams(buf, map[string]string{
+		"manifest.yaml": manifest,
+		"invalid.yaml":  invalidManifest,
+	}, "/some/where")
+}
+
+func TestK8sManifestSource(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newK8sTestParams(buf))
+
+	err := app.Run(newArgs("--k8s", "manifest.yaml"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "ORANGE", envmap["API_KEY"])
+	assert.Equal(t, "TIMELESS", envmap["TOKEN"])
+	assert.Equal(t, "blue", envmap["COLOR"])
+	assert.Equal(t, 3, len(envmap))
+}
+
+func TestK8sManifestSourceInvalidBase64(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newK8sTestParams(buf))
+
+	err := app.Run(newArgs("--k8s", "invalid.yaml"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fail to decode `DB_PASS` in Secret my-secret")
+}
+
+func TestK8sSecretOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newK8sTestParams(buf))
+
+	err := app.Run(newArgs("-o", "k8s-secret", "--k8s-namespace", "dev", "-d", "COLOR=BLUE"))
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: altenv-default
+  namespace: dev
+type: Opaque
+data:
+  COLOR: QkxVRQ==
+`, buf.String())
+}
+
+func TestK8sConfigMapOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newK8sTestParams(buf))
+
+	err := app.Run(newArgs("-o", "k8s-configmap", "--k8s-name", "my-config", "-d", "COLOR=BLUE"))
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-config
+data:
+  COLOR: BLUE
+`, buf.String())
+}
+
+func TestInvalidOutputFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newK8sTestParams(buf))
+
+	err := app.Run(newArgs("-o", "xxx", "-d", "COLOR=BLUE"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid output format")
+}
+
+func TestK8sOutputIgnoresHostEnv(t *testing.T) {
+	for _, policy := range []string{"keep", "deny"} {
+		buf := &bytes.Buffer{}
+		params := newK8sTestParams(buf)
+		params.ExtIO.Environ = func() []string { return []string{"COLOR=red"} }
+
+		err := NewApp(params).Run(newArgs("-o", "k8s-configmap", "--hostenv", policy, "-d", "COLOR=BLUE"))
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "  COLOR: BLUE\n", policy)
+	}
+}
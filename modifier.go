@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fileSourceTypes is set of varSource.Type that has file path in Path.
+var fileSourceTypes = map[string]bool{
+	"envfile":  true,
+	"dotenv":   true,
+	"jsonfile": true,
+	"yamlfile": true,
+	"tomlfile": true,
+	"k8sfile":  true,
+	"compose":  true,
+}
+
+// baseDir returns directory of the file that contains the variable.
+func (x varSource) baseDir() string {
+	if !fileSourceTypes[x.Type] || x.Path == "" {
+		return ""
+	}
+	return filepath.Dir(x.Path)
+}
+
+type valueModifier func(arg string, src varSource, ext ExtIOFunc) (string, error)
+
+var valueModifiers = []struct {
+	prefix string
+	modify valueModifier
+}{
+	{"@file:", modifyFile},
+	{"@json:", modifyJSON},
+	{"base64:", modifyBase64},
+	{"hex:", modifyHex},
+}
+
+// applyModifiers replaces values that have modifier prefix, e.g. `@file:`.
+func applyModifiers(vars []*envvar, ext ExtIOFunc) error {
+	for _, v := range vars {
+		for _, m := range valueModifiers {
+			if !strings.HasPrefix(v.Value, m.prefix) {
+				continue
+			}
+
+			value, err := m.modify(strings.TrimPrefix(v.Value, m.prefix), v.Source, ext)
+			if err != nil {
+				return errors.Wrapf(err, "Fail to modify value of `%s` (%s)", v.Key, v.Source)
+			}
+			v.Value = value
+			break
+		}
+	}
+
+	return nil
+}
+
+func readAllFile(path string, ext ExtIOFunc) ([]byte, error) {
+	fd, err := ext.OpenFunc(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to open %s", path)
+	}
+	defer fd.Close()
+
+	raw, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to read %s", path)
+	}
+	return raw, nil
+}
+
+func modifyFile(arg string, src varSource, ext ExtIOFunc) (string, error) {
+	raw, err := readAllFile(expandPath(arg, src.baseDir(), ext), ext)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func modifyJSON(arg string, src varSource, ext ExtIOFunc) (string, error) {
+	fpath, query := splitPathQuery(arg)
+
+	raw, err := readAllFile(expandPath(fpath, src.baseDir(), ext), ext)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := decodeOrderedJSON(bytes.NewReader(raw))
+	if err != nil {
+		return "", errors.Wrapf(err, "Fail to parse JSON file %s", fpath)
+	}
+
+	selected, err := selectPath(data, query)
+	if err != nil {
+		return "", err
+	}
+
+	if s, ok := selected.(string); ok {
+		return s, nil
+	}
+
+	encoded, err := json.Marshal(selected)
+	if err != nil {
+		return "", errors.Wrap(err, "Fail to encode selected JSON value")
+	}
+	return string(encoded), nil
+}
+
+func modifyBase64(arg string, src varSource, ext ExtIOFunc) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(arg)
+	if err != nil {
+		return "", errors.Wrap(err, "Fail to decode base64")
+	}
+	return string(raw), nil
+}
+
+func modifyHex(arg string, src varSource, ext ExtIOFunc) (string, error) {
+	raw, err := hex.DecodeString(arg)
+	if err != nil {
+		return "", errors.Wrap(err, "Fail to decode hex")
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,67 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newModifierTestApp(buf *bytes.Buffer) *Parameters {
+	files := map[string]string{
+		"/path/to/my.env":       "CERT=@file:certs/ca.pem\nCONF=@json:conf.json#.db.hosts.1",
+		"/path/to/certs/ca.pem": "-----BEGIN CERTIFICATE-----",
+		"/path/to/conf.json":    `{"db":{"hosts":["blue","orange"],"port":5432}}`,
+		"/home/blue/token":      "TIMELESS",
+	}
+	return newTestParams(buf, files, "/some/where", "HOME=/home/blue")
+}
+
+func TestModifierRelativeToContainingFile(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newModifierTestApp(buf))
+
+	err := app.Run(newArgs("-e", "/path/to/my.env"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----", envmap["CERT"])
+	assert.Equal(t, "orange", envmap["CONF"])
+}
+
+func TestModifierDefines(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newModifierTestApp(buf))
+
+	err := app.Run(newArgs(
+		"-d", "TOKEN=@file:~/token",
+		"-d", "B64=base64:QkxVRQ==",
+		"-d", "HEX=hex:4f52414e4745",
+		"-d", "DB=@json:/path/to/conf.json#.db",
+	))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "TIMELESS", envmap["TOKEN"])
+	assert.Equal(t, "BLUE", envmap["B64"])
+	assert.Equal(t, "ORANGE", envmap["HEX"])
+	assert.Equal(t, `{"hosts":["blue","orange"],"port":5432}`, envmap["DB"])
+}
+
+func TestModifierInvalidBase64(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newModifierTestApp(buf))
+
+	err := app.Run(newArgs("-d", "B64=base64:Qk xVRQ=="))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fail to decode base64")
+}
+
+func TestModifierFileNotFound(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newModifierTestApp(buf))
+
+	err := app.Run(newArgs("-d", "CERT=@file:no-such-file"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fail to modify value of `CERT`")
+}
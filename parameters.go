@@ -3,6 +3,8 @@ package main
 import (
 	"io"
 	"os"
+	"path/filepath"
+	"time"
 
 	cli "github.com/urfave/cli/v2"
 )
@@ -11,19 +13,54 @@ func wrapOSOpen(name string) (io.ReadCloser, error) {
 	return os.Open(name)
 }
 
+// wrapOSCreate creates a file that only owner can read and write. Parent
+// directories are also created.
+func wrapOSCreate(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+}
+
 type parameters struct {
-	EnvFiles  cli.StringSlice
-	JSONFiles cli.StringSlice
-	Defines   cli.StringSlice
-	Keychains cli.StringSlice
-	Prompt    string
-	Stdin     string
+	EnvFiles     cli.StringSlice
+	JSONFiles    cli.StringSlice
+	YAMLFiles    cli.StringSlice
+	TOMLFiles    cli.StringSlice
+	K8sFiles     cli.StringSlice
+	ComposeFiles cli.StringSlice
+	Defines      cli.StringSlice
+	Keychains    cli.StringSlice
+	Prompt       string
+	Stdin        string
 
 	Profile               string
 	ConfigPath            string
 	LogLevel              string
 	Overwrite             string
+	HostEnv               string
+	Nested                string
+	Template              bool
+	Supervise             bool
+	Redact                bool
+	Watch                 bool
+	WatchInterval         time.Duration
+	StopSignal            string
+	StopTimeout           time.Duration
+	Dotenv                string
+	Coerce                bool
+	Flatten               bool
+	FlattenSeparator      string
+	ArrayFormat           string
+	ArraySeparator        string
 	RunMode               string
+	OutputFormat          string
+	Provenance            bool
+	K8sName               string
+	K8sNamespace          string
+	DiffProfile           string
+	DiffDir               string
+	DiffConfig            string
 	WriteKeyChain         string
 	KeychainServicePrefix string
 
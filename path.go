@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// homeDir returns home directory from inherited environment variables.
+func homeDir(ext ExtIOFunc) string {
+	return ext.getenv("HOME")
+}
+
+// expandPath expands `~` to home directory and resolves relative path from
+// baseDir. path is not changed if baseDir is empty.
+func expandPath(path, baseDir string, ext ExtIOFunc) string {
+	if path == "~" {
+		return homeDir(ext)
+	} else if strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir(ext), path[2:])
+	}
+
+	if baseDir != "" && !filepath.IsAbs(path) {
+		return filepath.Join(baseDir, path)
+	}
+
+	return path
+}
+
+// expandConfigPath expands `$VAR` (and `${VAR}`) with inherited environment
+// variables in addition to expandPath.
+func expandConfigPath(path, baseDir string, ext ExtIOFunc) string {
+	return expandPath(os.Expand(path, ext.getenv), baseDir, ext)
+}
+
+// splitOptional splits `?path` style file entry into path and optional flag.
+func splitOptional(entry string) (string, bool) {
+	if strings.HasPrefix(entry, "?") {
+		return entry[1:], true
+	}
+	return entry, false
+}
+
+// resolveFileEntry resolves path of file entry in config from baseDir.
+// Optional mark `?` is kept.
+func resolveFileEntry(entry, baseDir string, ext ExtIOFunc) string {
+	path, optional := splitOptional(entry)
+	path = expandConfigPath(path, baseDir, ext)
+	if optional {
+		return "?" + path
+	}
+	return path
+}
+
+// resolveFileEntries resolves paths of file entries in config from baseDir.
+func resolveFileEntries(entries []string, baseDir string, ext ExtIOFunc) []string {
+	var resolved []string
+	for _, entry := range entries {
+		resolved = append(resolved, resolveFileEntry(entry, baseDir, ext))
+	}
+	return resolved
+}
+
+// expandFileEntries converts file entries to paths of files to be loaded.
+// Glob pattern is expanded to matched files in sorted order. Optional entry
+// (`?path`) is skipped if the file does not exist or no file matches.
+func expandFileEntries(entries []string, ext ExtIOFunc) ([]string, error) {
+	var paths []string
+
+	for _, entry := range entries {
+		path, optional := splitOptional(entry)
+
+		if hasGlobMeta(path) {
+			matches, err := ext.glob(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Fail to expand glob pattern %s", path)
+			}
+			if len(matches) == 0 {
+				if !optional {
+					return nil, fmt.Errorf("No file matches with %s", path)
+				}
+				logger.WithField("pattern", path).Debug("Skip optional glob pattern")
+			}
+			paths = append(paths, matches...)
+			continue
+		}
+
+		if optional {
+			fd, err := ext.OpenFunc(path)
+			if os.IsNotExist(err) {
+				logger.WithField("path", path).Debug("Skip optional file")
+				continue
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "Fail to open %s", path)
+			}
+			fd.Close()
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// expandQueryFileEntries is expandFileEntries for structured data files whose
+// entry may have subtree query, e.g. `?conf/*.json#.path.to`. The query is
+// split before checking existence and expanding glob, then attached to each
+// path again.
+func expandQueryFileEntries(entries []string, ext ExtIOFunc) ([]string, error) {
+	var paths []string
+
+	for _, entry := range entries {
+		path, query := splitPathQuery(entry)
+		matches, err := expandFileEntries([]string{path}, ext)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if query != "" {
+				match += "#" + query
+			}
+			paths = append(paths, match)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,137 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runPathTest(files map[string]string, cwd string, args ...string) (map[string]string, error) {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, files, cwd, "HOME=/home/blue", "STAGE=dev")
+	err := NewApp(params).Run(newArgs(args...))
+	return toEnvVars(buf), err
+}
+
+func TestPathRelativeToConfigFile(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[global]
+envfile = ["common.env"]
+jsonfile = ["data/common.json"]
+`,
+		"/conf/common.env":       "COLOR=blue",
+		"/conf/data/common.json": `{"MAGIC":"5"}`,
+	}
+
+	vars, err := runPathTest(files, "/somewhere", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "blue", "MAGIC": "5"}, vars)
+}
+
+func TestPathRelativeToWorkdir(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[workdir.proj1]
+dirpath = "~/proj1"
+envfile = [".env"]
+`,
+		"/home/blue/proj1/.env": "COLOR=blue",
+	}
+
+	vars, err := runPathTest(files, "/home/blue/proj1/src/pkg", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "blue"}, vars)
+}
+
+func TestPathExpandHomeAndEnvVar(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[global]
+envfile = ["~/common.env", "$HOME/${STAGE}.env"]
+`,
+		"/home/blue/common.env": "COLOR=blue",
+		"/home/blue/dev.env":    "MAGIC=5",
+	}
+
+	vars, err := runPathTest(files, "/somewhere", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "blue", "MAGIC": "5"}, vars)
+}
+
+func TestPathOptionalEntry(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[global]
+envfile = ["common.env", "?local.env", "?missing.env"]
+overwrite = "allow"
+`,
+		"/conf/common.env": "COLOR=blue",
+		"/conf/local.env":  "COLOR=red",
+	}
+
+	vars, err := runPathTest(files, "/somewhere", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "red"}, vars)
+}
+
+func TestPathMissingEntry(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[global]
+envfile = ["missing.env"]
+`,
+	}
+
+	_, err := runPathTest(files, "/somewhere", "-c", "/conf/altenv.toml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/conf/missing.env")
+}
+
+func TestPathGlobEntry(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[global]
+envfile = ["env.d/*.env", "?none.d/*.env"]
+overwrite = "allow"
+`,
+		"/conf/env.d/20-override.env": "COLOR=red",
+		"/conf/env.d/10-base.env":     "COLOR=blue\nMAGIC=5",
+	}
+
+	vars, err := runPathTest(files, "/somewhere", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"COLOR": "red", "MAGIC": "5"}, vars)
+}
+
+func TestPathGlobNoMatch(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[global]
+envfile = ["env.d/*.env"]
+`,
+	}
+
+	_, err := runPathTest(files, "/somewhere", "-c", "/conf/altenv.toml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No file matches with /conf/env.d/*.env")
+}
+
+func TestPathEntryWithSubtreeQuery(t *testing.T) {
+	files := map[string]string{
+		"/conf/altenv.toml": `
+[global]
+jsonfile = ["?cfg.json#.dev", "?missing.json#.dev", "json.d/*.json#.prod"]
+`,
+		"/conf/cfg.json":          `{"dev": {"A": "1"}}`,
+		"/conf/json.d/10-db.json": `{"prod": {"DB": "db.local"}}`,
+		"/conf/json.d/20-ap.json": `{"prod": {"AP": "ap.local"}}`,
+	}
+
+	vars, err := runPathTest(files, "/somewhere", "-c", "/conf/altenv.toml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "1", "DB": "db.local", "AP": "ap.local"}, vars)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var safeShellArg = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+
+func quoteShellArg(arg string) string {
+	if safeShellArg.MatchString(arg) {
+		return arg
+	}
+	return posixQuote(arg)
+}
+
+type planEntry struct {
+	key  string
+	line string
+}
+
+// planCommand outputs how exec mode changes current environment and the
+// command to be executed, without executing it.
+func planCommand(vars []*envvar, args []string, config altenvConfig, ext ExtIOFunc) error {
+	host := ext.environ()
+	hostmap := splitEnviron(host)
+
+	files, err := tempFilePlaceholders(config.TempFiles, vars)
+	if err != nil {
+		return err
+	}
+	vars = append(vars, files...)
+
+	var applied []*envvar
+	if config.hostEnv == hostEnvDeny {
+		// Collisions are reported as denied instead of failing at the first one
+		for _, v := range vars {
+			if _, ok := hostmap[v.Key]; !ok {
+				applied = append(applied, v)
+			}
+		}
+	} else {
+		applied, err = applyHostEnv(vars, host, config.hostEnv)
+		if err != nil {
+			return err
+		}
+	}
+
+	loaded := map[string]*envvar{}
+	for _, v := range vars {
+		loaded[v.Key] = v
+	}
+	// hostValue returns inherited value masked if the key is secret
+	hostValue := func(key string) string {
+		if v, ok := loaded[key]; ok && isSecret(v, config.Secrets) {
+			return maskedValue
+		}
+		if isSecret(&envvar{Key: key}, config.Secrets) {
+			return maskedValue
+		}
+		return hostmap[key]
+	}
+
+	var entries []planEntry
+	counts := map[string]int{}
+	add := func(change, key, line string) {
+		counts[change]++
+		entries = append(entries, planEntry{key: key, line: line})
+	}
+
+	appliedKeys := map[string]bool{}
+	for _, v := range applied {
+		appliedKeys[v.Key] = true
+		current, ok := hostmap[v.Key]
+		switch {
+		case !ok:
+			add("added", v.Key, fmt.Sprintf("+ %s=%s (from %s)", v.Key, displayValue(v, config.Secrets), v.Source))
+		case current != v.Value:
+			add("changed", v.Key, fmt.Sprintf("~ %s: %s -> %s (from %s)", v.Key, hostValue(v.Key), displayValue(v, config.Secrets), v.Source))
+		}
+	}
+	var denied []string
+	for _, v := range vars {
+		switch {
+		case appliedKeys[v.Key]:
+		case config.hostEnv == hostEnvDeny:
+			denied = append(denied, v.Key)
+			add("denied", v.Key, fmt.Sprintf("x %s=%s (from %s) is denied by inherited value %s", v.Key, displayValue(v, config.Secrets), v.Source, hostValue(v.Key)))
+		default:
+			add("shadowed", v.Key, fmt.Sprintf("! %s=%s (from %s) is shadowed by inherited value %s", v.Key, displayValue(v, config.Secrets), v.Source, hostValue(v.Key)))
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	lines := []string{"# environment changes"}
+	for _, entry := range entries {
+		lines = append(lines, entry.line)
+	}
+	lines = append(lines, fmt.Sprintf("%d added, %d changed, %d shadowed, %d denied",
+		counts["added"], counts["changed"], counts["shadowed"], counts["denied"]))
+
+	lines = append(lines, "# command")
+	var lookErr error
+	if len(args) == 0 {
+		lines = append(lines, "(no command is given)")
+	} else {
+		binary, err := exec.LookPath(args[0])
+		if err != nil {
+			lookErr = err
+			binary = "(not found)"
+		}
+
+		var argv []string
+		for _, arg := range args {
+			argv = append(argv, quoteShellArg(arg))
+		}
+		lines = append(lines, "binary: "+binary, "argv: "+strings.Join(argv, " "))
+	}
+
+	if err := writeLines(ext.DryRunOutput, lines); err != nil {
+		return err
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return fmt.Errorf("Deny to overwrite inherited environment variable: %s", strings.Join(denied, ", "))
+	}
+	if lookErr != nil {
+		return errors.Wrapf(lookErr, "Fail to find command: %s", args[0])
+	}
+	return nil
+}
+
+func writeLines(w io.Writer, lines []string) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return errors.Wrap(err, "Fail to output plan")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runPlanTest(environ []string, args ...string) (string, error) {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, nil, "/some/where", environ...)
+	err := NewApp(params).Run(append([]string{"altenv", "-r", "plan"}, args...))
+	return buf.String(), err
+}
+
+func TestPlan(t *testing.T) {
+	out, err := runPlanTest(
+		[]string{"COLOR=red", "MAGIC=5", "AWS_PROFILE=dev", "AWS_REGION=us-east-1", "PATH=/bin"},
+		"-d", "COLOR=blue", "-d", "MAGIC=5", "-d", "NEW=1",
+		"/bin/sh", "-c", "echo $COLOR",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, `# environment changes
+~ COLOR: red -> blue (from define)
++ NEW=1 (from define)
+1 added, 1 changed, 0 shadowed, 0 denied
+# command
+binary: /bin/sh
+argv: /bin/sh -c 'echo $COLOR'
+`, out)
+}
+
+func TestPlanShadowed(t *testing.T) {
+	out, err := runPlanTest(
+		[]string{"COLOR=red", "ALTENV_PROFILE=base"},
+		"-d", "COLOR=blue", "--hostenv", "keep", "--nested", "deny",
+	)
+	require.NoError(t, err)
+	assert.Contains(t, out, "! COLOR=blue (from define) is shadowed by inherited value red\n")
+	assert.NotContains(t, out, "ALTENV_PROFILE")
+	assert.Contains(t, out, "# command\n(no command is given)\n")
+}
+
+func TestPlanDenied(t *testing.T) {
+	out, err := runPlanTest(
+		[]string{"COLOR=red", "MAGIC=5"},
+		"-d", "COLOR=blue", "-d", "MAGIC=6", "-d", "NEW=1", "--hostenv", "deny",
+	)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Deny to overwrite inherited environment variable: COLOR, MAGIC")
+	assert.Contains(t, out, `# environment changes
+x COLOR=blue (from define) is denied by inherited value red
+x MAGIC=6 (from define) is denied by inherited value 5
++ NEW=1 (from define)
+1 added, 0 changed, 0 shadowed, 2 denied
+`)
+}
+
+func TestPlanK8sSecret(t *testing.T) {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, map[string]string{
+		"/conf/s.yaml": "kind: Secret\nmetadata:\n  name: db\nstringData:\n  PW: hunter2\n",
+	}, "/some/where")
+
+	err := NewApp(params).Run([]string{"altenv", "-r", "plan", "--k8s", "/conf/s.yaml"})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "+ PW=******** (from k8sfile:/conf/s.yaml)\n")
+	assert.NotContains(t, buf.String(), "hunter2")
+}
+
+func TestPlanCommandNotFound(t *testing.T) {
+	out, err := runPlanTest(nil, "no-such-command-for-altenv-test")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fail to find command: no-such-command-for-altenv-test")
+	assert.Contains(t, out, "binary: (not found)\n")
+}
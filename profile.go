@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitProfiles splits `a,b` style profile option into profile names.
+func splitProfiles(profile string) []string {
+	var profiles []string
+	for _, name := range strings.Split(profile, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			profiles = append(profiles, name)
+		}
+	}
+	return profiles
+}
+
+type profileResolver struct {
+	files    []*configFile
+	cond     *conditionContext
+	applied  map[string]bool
+	visiting []string
+	configs  []altenvConfig
+	skipped  []string
+}
+
+// resolveProfiles returns profile sections to be merged in order. Profiles
+// in `extends` are resolved before the profile itself, and each profile is
+// merged only once. Sections that do not match `when` condition are
+// returned as skipped, and their `extends` are not resolved.
+func resolveProfiles(files []*configFile, names []string, cond *conditionContext) ([]altenvConfig, []string, error) {
+	resolver := &profileResolver{
+		files:   files,
+		cond:    cond,
+		applied: map[string]bool{},
+	}
+
+	for _, name := range names {
+		if err := resolver.resolve(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return resolver.configs, resolver.skipped, nil
+}
+
+func hasProfile(files []*configFile, name string) bool {
+	for _, file := range files {
+		if _, ok := file.Profiles[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *profileResolver) resolve(name string) error {
+	if x.applied[name] {
+		return nil
+	}
+	for _, v := range x.visiting {
+		if v == name {
+			return fmt.Errorf("Circular extends of profile: %s -> %s", strings.Join(x.visiting, " -> "), name)
+		}
+	}
+	x.visiting = append(x.visiting, name)
+
+	// Sections of the same profile in multiple files are layered in order
+	var sections []altenvConfig
+	var extends []string
+	for _, file := range x.files {
+		if section, ok := file.Profiles[name]; ok {
+			// Conditions are not evaluated if cond is nil
+			if x.cond != nil {
+				if matched, err := matchCondition(section.When, x.cond); err != nil {
+					return err
+				} else if !matched {
+					x.skipped = append(x.skipped, section.section)
+					continue
+				}
+			}
+			sections = append(sections, section)
+			extends = append(extends, section.Extends...)
+		}
+	}
+
+	for _, parent := range extends {
+		if !hasProfile(x.files, parent) {
+			return fmt.Errorf("profile `%s` extended by `%s` is not found in config file", parent, name)
+		}
+		if err := x.resolve(parent); err != nil {
+			return err
+		}
+	}
+
+	x.visiting = x.visiting[:len(x.visiting)-1]
+	x.applied[name] = true
+	x.configs = append(x.configs, sections...)
+	logger.WithField("profile", name).Debug("Apply profile config")
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runProfileTest(configData string, args ...string) (map[string]string, error) {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, map[string]string{"testconfig": configData}, "/some/where")
+	err := NewApp(params).Run(newArgs(append([]string{"-c", "testconfig"}, args...)...))
+	return toEnvVars(buf), err
+}
+
+const profileTestConfig = `
+[global]
+overwrite = "allow"
+
+[profile.base]
+define = ["LOG_LEVEL=info", "APP=myapp", "ORDER=base"]
+
+[profile.aws-common]
+define = ["AWS_REGION=us-east-1", "ORDER=aws-common"]
+
+[profile.staging]
+extends = ["base", "aws-common"]
+define = ["STAGE=staging", "ORDER=staging"]
+
+[profile.prod]
+extends = ["staging"]
+define = ["STAGE=prod", "LOG_LEVEL=warn", "ORDER=prod"]
+
+[profile.debug]
+define = ["LOG_LEVEL=debug", "ORDER=debug"]
+
+[profile.loop1]
+extends = ["loop2"]
+
+[profile.loop2]
+extends = ["loop1"]
+
+[profile.broken]
+extends = ["nothing"]
+`
+
+func TestProfileExtends(t *testing.T) {
+	envmap, err := runProfileTest(profileTestConfig, "-p", "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "myapp", envmap["APP"])
+	assert.Equal(t, "us-east-1", envmap["AWS_REGION"])
+	assert.Equal(t, "prod", envmap["STAGE"])
+	assert.Equal(t, "warn", envmap["LOG_LEVEL"])
+	assert.Equal(t, "prod", envmap["ORDER"])
+}
+
+func TestProfileStack(t *testing.T) {
+	envmap, err := runProfileTest(profileTestConfig, "-p", "prod,debug")
+	require.NoError(t, err)
+	assert.Equal(t, "prod", envmap["STAGE"])
+	assert.Equal(t, "debug", envmap["LOG_LEVEL"])
+	assert.Equal(t, "debug", envmap["ORDER"])
+
+	// base is already applied by staging and is not merged again
+	envmap, err = runProfileTest(profileTestConfig, "-p", "staging,base")
+	require.NoError(t, err)
+	assert.Equal(t, "staging", envmap["ORDER"])
+}
+
+func TestProfileExtendsError(t *testing.T) {
+	_, err := runProfileTest(profileTestConfig, "-p", "loop1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Circular extends of profile: loop1 -> loop2 -> loop1")
+
+	_, err = runProfileTest(profileTestConfig, "-p", "broken")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profile `nothing` extended by `broken` is not found")
+
+	_, err = runProfileTest(profileTestConfig, "-p", "prod,nothing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profile `nothing` is not found in config file")
+}
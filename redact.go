@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	redactedValue = "***"
+	// minRedactLength is minimum length of secret value to be redacted. Too
+	// short value would redact unrelated output.
+	minRedactLength = 4
+)
+
+// secretValues returns values of secret variables to be redacted.
+func secretValues(vars []*envvar, patterns []string) []string {
+	var values []string
+	for _, v := range vars {
+		if isSecret(v, patterns) {
+			values = append(values, v.Value)
+		}
+	}
+	return values
+}
+
+// redactPatterns returns secret values and their common encodings (base64 and
+// hex) sorted by length, longest first.
+func redactPatterns(secrets []string) [][]byte {
+	seen := map[string]bool{}
+	var patterns [][]byte
+	add := func(s string) {
+		if len(s) >= minRedactLength && !seen[s] {
+			seen[s] = true
+			patterns = append(patterns, []byte(s))
+		}
+	}
+
+	for _, secret := range secrets {
+		if len(secret) < minRedactLength {
+			continue
+		}
+		raw := []byte(secret)
+		add(secret)
+		add(base64.StdEncoding.EncodeToString(raw))
+		add(base64.RawStdEncoding.EncodeToString(raw))
+		add(base64.URLEncoding.EncodeToString(raw))
+		add(base64.RawURLEncoding.EncodeToString(raw))
+		add(hex.EncodeToString(raw))
+		add(strings.ToUpper(hex.EncodeToString(raw)))
+	}
+
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return len(patterns[i]) > len(patterns[j])
+	})
+	return patterns
+}
+
+// redactor is io.WriteCloser that replaces secret values in the stream with
+// `***`. Data that may be beginning of a secret value is kept until next Write
+// or Close, then a secret value split into multiple writes is also redacted.
+type redactor struct {
+	w        io.Writer
+	patterns [][]byte
+	heads    [256]bool
+	pending  []byte
+}
+
+func newRedactor(w io.Writer, secrets []string) *redactor {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	x := &redactor{w: w, patterns: redactPatterns(secrets)}
+	for _, p := range x.patterns {
+		x.heads[p[0]] = true
+	}
+	return x
+}
+
+func (x *redactor) Write(p []byte) (int, error) {
+	x.pending = append(x.pending, p...)
+	if err := x.flush(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes all kept data. It does not close underlying writer.
+func (x *redactor) Close() error {
+	return x.flush(true)
+}
+
+// partial returns true if data is shorter than a secret value and beginning of
+// it.
+func (x *redactor) partial(data []byte) bool {
+	for _, p := range x.patterns {
+		if len(data) < len(p) && bytes.HasPrefix(p, data) {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *redactor) flush(final bool) error {
+	var out []byte
+	i := 0
+
+scan:
+	for i < len(x.pending) {
+		if !x.heads[x.pending[i]] {
+			out = append(out, x.pending[i])
+			i++
+			continue
+		}
+
+		rest := x.pending[i:]
+		if !final && x.partial(rest) {
+			break
+		}
+		for _, p := range x.patterns {
+			if bytes.HasPrefix(rest, p) {
+				out = append(out, redactedValue...)
+				i += len(p)
+				continue scan
+			}
+		}
+		out = append(out, x.pending[i])
+		i++
+	}
+
+	x.pending = append([]byte{}, x.pending[i:]...)
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := x.w.Write(out)
+	return err
+}
@@ -0,0 +1,63 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactorSplitWrites(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewRedactor(buf, []string{"s3cr3t-value", "abc"})
+
+	for _, c := range []byte("token=s3cr3t-value; short=abc; s3cr3t\n") {
+		_, err := w.Write([]byte{c})
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, "token=***; short=abc; s3cr3t\n", buf.String())
+}
+
+func TestRedactorLongestMatch(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewRedactor(buf, []string{"pass", "password123"})
+
+	_, err := w.Write([]byte("x=password"))
+	require.NoError(t, err)
+	assert.Equal(t, "x=", buf.String())
+	_, err = w.Write([]byte("123 y=pass!"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "x=*** y=***!", buf.String())
+}
+
+func TestRedactorEncodings(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewRedactor(buf, []string{"s3cr3t?"})
+
+	// base64 (padded and unpadded) and hex (lower and upper case) of "s3cr3t?"
+	_, err := w.Write([]byte("czNjcjN0Pw== czNjcjN0Pw 7333637233743f 7333637233743F\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "*** *** *** ***\n", buf.String())
+}
+
+func TestRedactOutputOfCommand(t *testing.T) {
+	stdout, stderr := &notifyWriter{}, &notifyWriter{}
+	files := map[string]string{"/conf/altenv.toml": `
+[global]
+secret = ["*_TOKEN"]
+define = ["API_TOKEN=tk-0123456789", "COLOR=blue"]
+`}
+	params := newTestParams(&bytes.Buffer{}, files, "/some/where", "PATH=/bin:/usr/bin")
+	params.ExtIO.Stdout, params.ExtIO.Stderr = stdout, stderr
+
+	err := NewApp(params).Run([]string{"altenv", "-c", "/conf/altenv.toml", "--redact", "/bin/sh", "-c",
+		`printf 'token=tk-01234'; sleep 0.1; printf '56789 color=%s\n' "$COLOR"; printf %s "$API_TOKEN" | base64 >&2`})
+	require.NoError(t, err)
+	assert.Equal(t, "token=*** color=blue\n", stdout.String())
+	assert.Equal(t, "***\n", stderr.String())
+}
@@ -0,0 +1,33 @@
+package main
+
+// secretSourceTypes is set of varSource.Type whose values are always secret.
+var secretSourceTypes = map[string]bool{
+	"keychain": true,
+	"prompt":   true,
+	// pre hooks are expected to output credentials, e.g. refreshed tokens
+	"pre": true,
+}
+
+const maskedValue = "********"
+
+// isSecret returns true if the variable comes from secret source (or secret
+// resource) or its key matches with one of patterns in `secret` config.
+func isSecret(v *envvar, patterns []string) bool {
+	if v.secret || secretSourceTypes[v.Source.Type] {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchPattern(pattern, v.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayValue returns value of the variable to be shown to user.
+func displayValue(v *envvar, patterns []string) string {
+	if isSecret(v, patterns) {
+		return maskedValue
+	}
+	return v.Value
+}
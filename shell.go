@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// profileMarkerKey has profile activated by altenv. Nested profiles are
+	// joined by `>`, e.g. `dev>prod`.
+	profileMarkerKey = "ALTENV_PROFILE"
+	// sourcesMarkerKey has comma separated sources of loaded variables.
+	sourcesMarkerKey = "ALTENV_SOURCES"
+)
+
+// checkNestedProfile checks if a profile is already activated by altenv with
+// nested policy. It returns profile stacked on the active one.
+func checkNestedProfile(profile string, host []string, policy nestedPolicy) (string, error) {
+	active, ok := splitEnviron(host)[profileMarkerKey]
+	if !ok {
+		return profile, nil
+	}
+
+	switch policy {
+	case nestedDeny:
+		return "", fmt.Errorf("Profile `%s` is already activated by altenv (%s). Exit the shell or use `--nested allow`", active, profileMarkerKey)
+	case nestedWarn:
+		logger.WithField("active", active).WithField("profile", profile).Warn("Profile is already activated by altenv, stacking new profile")
+	}
+	return active + ">" + profile, nil
+}
+
+// addProfileMarkers appends marker variables that show active profile and
+// sources to vars. profile should be returned by checkNestedProfile.
+func addProfileMarkers(vars []*envvar, profile string) []*envvar {
+	var sources []string
+	seen := map[string]bool{}
+	for _, v := range vars {
+		src := varSource{Type: v.Source.Type, Path: v.Source.Path}.String()
+		if !seen[src] {
+			seen[src] = true
+			sources = append(sources, src)
+		}
+	}
+
+	marker := varSource{Type: "altenv"}
+	return append(vars,
+		&envvar{Key: profileMarkerKey, Value: profile, Source: marker},
+		&envvar{Key: sourcesMarkerKey, Value: strings.Join(sources, ","), Source: marker},
+	)
+}
+
+// execShell launches $SHELL (or /bin/sh) with variables. args are passed to
+// the shell.
+func execShell(vars []*envvar, args []string, config altenvConfig, ext ExtIOFunc) error {
+	shell := ext.getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	logger.WithField("shell", shell).Debug("Launch shell")
+	return execCommand(vars, append([]string{shell}, args...), config, ext)
+}
@@ -0,0 +1,83 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type execCall struct {
+	binary string
+	args   []string
+	env    map[string]string
+}
+
+func runShellTest(environ []string, args ...string) (*execCall, error) {
+	var call *execCall
+	files := map[string]string{"/conf/altenv.toml": `
+[profile.dev]
+define = ["COLOR=blue"]
+`}
+	params := newTestParams(&bytes.Buffer{}, files, "/some/where", environ...)
+	params.ExtIO.Exec = func(binary string, args []string, env []string) error {
+		call = &execCall{binary: binary, args: args, env: SplitEnviron(env)}
+		return nil
+	}
+
+	err := NewApp(params).Run(append([]string{"altenv", "-c", "/conf/altenv.toml"}, args...))
+	return call, err
+}
+
+func TestShellMode(t *testing.T) {
+	call, err := runShellTest([]string{"SHELL=/bin/sh", "PATH=/bin"}, "-r", "shell", "-p", "dev", "-d", "MAGIC=5", "--", "-i")
+	require.NoError(t, err)
+	require.NotNil(t, call)
+
+	assert.Equal(t, "/bin/sh", call.binary)
+	assert.Equal(t, []string{"/bin/sh", "-i"}, call.args)
+	assert.Equal(t, "blue", call.env["COLOR"])
+	assert.Equal(t, "5", call.env["MAGIC"])
+	assert.Equal(t, "/bin", call.env["PATH"])
+	assert.Equal(t, "dev", call.env["ALTENV_PROFILE"])
+	assert.Equal(t, "define", call.env["ALTENV_SOURCES"])
+}
+
+func TestShellModeNestedWarn(t *testing.T) {
+	call, err := runShellTest([]string{"SHELL=/bin/sh", "ALTENV_PROFILE=base"}, "-r", "shell", "-p", "dev")
+	require.NoError(t, err)
+	require.NotNil(t, call)
+	assert.Equal(t, "base>dev", call.env["ALTENV_PROFILE"])
+}
+
+func TestShellModeNestedDeny(t *testing.T) {
+	call, err := runShellTest([]string{"SHELL=/bin/sh", "ALTENV_PROFILE=base"}, "-r", "shell", "-p", "dev", "--nested", "deny")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Profile `base` is already activated by altenv")
+	assert.Nil(t, call)
+}
+
+func TestExecModeNoMarkers(t *testing.T) {
+	call, err := runShellTest([]string{"ALTENV_PROFILE=base"}, "-p", "dev", "--nested", "allow", "/bin/sh", "-c", "true")
+	require.NoError(t, err)
+	require.NotNil(t, call)
+
+	assert.Equal(t, []string{"/bin/sh", "-c", "true"}, call.args)
+	assert.Equal(t, map[string]string{
+		"COLOR":          "blue",
+		"ALTENV_PROFILE": "base",
+	}, call.env)
+}
+
+func TestExecModeNestedDeny(t *testing.T) {
+	call, err := runShellTest([]string{"ALTENV_PROFILE=base"}, "-p", "dev", "--nested", "deny", "/bin/sh", "-c", "true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Profile `base` is already activated by altenv")
+	assert.Nil(t, call)
+
+	_, err = runShellTest([]string{"ALTENV_PROFILE=base"}, "-p", "dev", "--nested", "deny", "-r", "dryrun")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Profile `base` is already activated by altenv")
+}
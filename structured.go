@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// orderedMap is an object of structured data (e.g. JSON) keeping key order.
+type orderedMap []orderedItem
+
+type orderedItem struct {
+	Key   string
+	Value interface{}
+}
+
+func (x orderedMap) get(key string) (interface{}, bool) {
+	for _, item := range x {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON encodes orderedMap as JSON object in original key order.
+func (x orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, item := range x {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, err := json.Marshal(item.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// decodeOrderedJSON decodes JSON data. Object is decoded into orderedMap and
+// number is kept as json.Number.
+func decodeOrderedJSON(fd io.Reader) (interface{}, error) {
+	dec := json.NewDecoder(fd)
+	dec.UseNumber()
+
+	data, err := decodeOrderedJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Invalid JSON data after top-level value")
+	}
+	return data, nil
+}
+
+func decodeOrderedJSONValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := orderedMap{}
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyToken.(string)
+			if !ok {
+				return nil, fmt.Errorf("Invalid JSON object key: %v", keyToken)
+			}
+			value, err := decodeOrderedJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, orderedItem{Key: key, Value: value})
+		}
+		if _, err := dec.Token(); err != nil { // consume '}'
+			return nil, err
+		}
+		return obj, nil
+
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrderedJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil { // consume ']'
+			return nil, err
+		}
+		return arr, nil
+
+	default:
+		return token, nil
+	}
+}
+
+// splitPathQuery splits `file.json#.path.to` into file path and query.
+func splitPathQuery(entry string) (string, string) {
+	if pos := strings.LastIndex(entry, "#."); pos >= 0 {
+		return entry[:pos], entry[pos+1:]
+	}
+	return entry, ""
+}
+
+// selectPath returns a part of data specified by path such as `.a.b.0`.
+// Array elements are selected by index.
+func selectPath(data interface{}, path string) (interface{}, error) {
+	current := data
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+
+		switch v := current.(type) {
+		case orderedMap:
+			child, ok := v.get(key)
+			if !ok {
+				return nil, fmt.Errorf("`%s` is not found in path `%s`", key, path)
+			}
+			current = child
+
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || len(v) <= idx {
+				return nil, fmt.Errorf("Invalid index `%s` in path `%s`", key, path)
+			}
+			current = v[idx]
+
+		default:
+			return nil, fmt.Errorf("Can not select `%s` from non-object value in path `%s`", key, path)
+		}
+	}
+
+	return current, nil
+}
+
+// structOptions is options to convert structured data to variables.
+type structOptions struct {
+	Coerce         bool
+	Flatten        bool
+	Separator      string
+	ArrayFormat    string
+	ArraySeparator string
+}
+
+const (
+	arrayFormatDeny = "deny"
+	arrayFormatJoin = "join"
+	arrayFormatJSON = "json"
+)
+
+// structToEnvVars converts object of structured data to variables.
+func structToEnvVars(data interface{}, opts structOptions) ([]*envvar, error) {
+	obj, ok := data.(orderedMap)
+	if !ok {
+		return nil, fmt.Errorf("Top level data must be object (map)")
+	}
+
+	var envvars []*envvar
+	if err := flattenObject(obj, "", opts, &envvars); err != nil {
+		return nil, err
+	}
+	return envvars, nil
+}
+
+func flattenObject(obj orderedMap, prefix string, opts structOptions, envvars *[]*envvar) error {
+	for _, item := range obj {
+		key := prefix + item.Key
+
+		switch v := item.Value.(type) {
+		case orderedMap:
+			if !opts.Flatten {
+				return fmt.Errorf("`%s` has nested object, flatten option is required", key)
+			}
+			if err := flattenObject(v, key+opts.Separator, opts, envvars); err != nil {
+				return err
+			}
+
+		case []interface{}:
+			value, err := arrayToString(key, v, opts)
+			if err != nil {
+				return err
+			}
+			*envvars = append(*envvars, &envvar{Key: key, Value: value})
+
+		default:
+			value, err := scalarToString(key, v, opts)
+			if err != nil {
+				return err
+			}
+			*envvars = append(*envvars, &envvar{Key: key, Value: value})
+		}
+	}
+
+	return nil
+}
+
+func arrayToString(key string, arr []interface{}, opts structOptions) (string, error) {
+	switch opts.ArrayFormat {
+	case arrayFormatJoin:
+		var values []string
+		for _, elem := range arr {
+			switch elem.(type) {
+			case orderedMap, []interface{}:
+				return "", fmt.Errorf("`%s` has nested value in array, can not join", key)
+			}
+			s, err := scalarToString(key, elem, opts)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, s)
+		}
+		return strings.Join(values, opts.ArraySeparator), nil
+
+	case arrayFormatJSON:
+		raw, err := json.Marshal(arr)
+		if err != nil {
+			return "", errors.Wrapf(err, "Fail to encode array of `%s`", key)
+		}
+		return string(raw), nil
+
+	default:
+		return "", fmt.Errorf("`%s` has array value, array format option is required", key)
+	}
+}
+
+func scalarToString(key string, value interface{}, opts structOptions) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		// null has been loaded as empty value
+		return "", nil
+	}
+	if !opts.Coerce {
+		return "", fmt.Errorf("`%s` has non-string value, coerce option is required", key)
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// exitError is returned when a supervised command exits with non-zero status.
+// main exits altenv with the same status.
+type exitError struct {
+	code   int
+	signal syscall.Signal
+}
+
+func (x *exitError) Error() string {
+	if x.signal != 0 {
+		return fmt.Sprintf("Command is terminated by signal: %s", x.signal)
+	}
+	return fmt.Sprintf("Command exited with status %d", x.code)
+}
+
+// exitStatus returns exit status of altenv if err is caused by exit of
+// supervised command.
+func exitStatus(err error) (int, bool) {
+	exitErr, ok := errors.Cause(err).(*exitError)
+	if !ok {
+		return 0, false
+	}
+	return exitErr.code, true
+}
+
+// exitBySignal terminates altenv by the same signal as the supervised command
+// so that parent process can see it. It exits with status 128+signal if
+// altenv is not terminated.
+func exitBySignal(err error) {
+	exitErr, ok := errors.Cause(err).(*exitError)
+	if !ok {
+		return
+	}
+	if exitErr.signal != 0 {
+		signal.Reset(exitErr.signal)
+		if err := syscall.Kill(os.Getpid(), exitErr.signal); err == nil {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	os.Exit(exitErr.code)
+}
+
+// exitResult is result of supervised command passed to post-exit functions.
+type exitResult struct {
+	args     []string
+	code     int
+	signal   syscall.Signal
+	duration time.Duration
+}
+
+// postExitFunc is called after exit of supervised command.
+type postExitFunc func(result exitResult) error
+
+// supervisor runs a command as child process of altenv, and waits for it.
+type supervisor struct {
+	ext      ExtIOFunc
+	postExit []postExitFunc
+
+	// stop requests to stop the command by stopSignal. The command is killed
+	// if it does not exit in stopTimeout.
+	stop        chan struct{}
+	stopSignal  os.Signal
+	stopTimeout time.Duration
+}
+
+func newSupervisor(ext ExtIOFunc) *supervisor {
+	return &supervisor{
+		ext:         ext,
+		stop:        make(chan struct{}, 1),
+		stopSignal:  syscall.SIGTERM,
+		stopTimeout: 10 * time.Second,
+	}
+}
+
+// requestStop stops the running command gracefully. It does not wait for
+// exit of the command.
+func (x *supervisor) requestStop() {
+	select {
+	case x.stop <- struct{}{}:
+	default:
+	}
+}
+
+// addPostExit adds a function called after exit of the command. Functions are
+// called in order of addition.
+func (x *supervisor) addPostExit(f postExitFunc) {
+	x.postExit = append(x.postExit, f)
+}
+
+// ttySignals are sent by terminal to all processes in the foreground process
+// group. They are not forwarded to the command to avoid duplicated delivery.
+var ttySignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGWINCH,
+}
+
+// jobControlSignals stop altenv together with the command if stdin is TTY.
+var jobControlSignals = []os.Signal{
+	syscall.SIGTSTP,
+	syscall.SIGTTIN,
+	syscall.SIGTTOU,
+}
+
+// isTerminal returns true if r is a character device, e.g. TTY.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// run starts binary with args and env, forwards signals to it until exit and
+// calls post-exit functions. It returns *exitError if the command exits with
+// non-zero status, or an error of post-exit function.
+func (x *supervisor) run(binary string, args []string, env []string) error {
+	cmd := &exec.Cmd{
+		Path:   binary,
+		Args:   args,
+		Env:    env,
+		Stdin:  x.ext.Stdin,
+		Stdout: x.ext.Stdout,
+		Stderr: x.ext.Stderr,
+	}
+
+	tty := isTerminal(x.ext.Stdin)
+	skip := map[os.Signal]bool{
+		syscall.SIGCHLD: true,
+		syscall.SIGURG:  true, // used by Go runtime for preemption
+	}
+	if tty {
+		for _, sig := range ttySignals {
+			skip[sig] = true
+		}
+	}
+
+	sigCh := make(chan os.Signal, 16)
+	signal.Notify(sigCh)
+	if tty {
+		signal.Reset(jobControlSignals...)
+	}
+	defer signal.Stop(sigCh)
+
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "Fail to start: %v", args)
+	}
+	logger.WithFields(logrus.Fields{
+		"pid":  cmd.Process.Pid,
+		"args": args,
+		"tty":  tty,
+	}).Debug("Started supervised command")
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var waitErr error
+	var killTimer <-chan time.Time
+	for waiting := true; waiting; {
+		select {
+		case <-x.stop:
+			logger.WithField("signal", x.stopSignal).Debug("Stop supervised command")
+			if err := cmd.Process.Signal(x.stopSignal); err != nil {
+				logger.WithError(err).Debug("Fail to send stop signal")
+			}
+			killTimer = time.After(x.stopTimeout)
+		case <-killTimer:
+			logger.WithField("timeout", x.stopTimeout).Warn("Command did not stop in time, kill it")
+			if err := cmd.Process.Kill(); err != nil {
+				logger.WithError(err).Debug("Fail to kill command")
+			}
+		case sig := <-sigCh:
+			if skip[sig] {
+				continue
+			}
+			logger.WithField("signal", sig).Debug("Forward signal")
+			if err := cmd.Process.Signal(sig); err != nil {
+				logger.WithError(err).WithField("signal", sig).Debug("Fail to forward signal")
+			}
+		case waitErr = <-done:
+			waiting = false
+		}
+	}
+
+	if cmd.ProcessState == nil {
+		return errors.Wrapf(waitErr, "Fail to wait: %v", args)
+	}
+	if _, ok := waitErr.(*exec.ExitError); waitErr != nil && !ok {
+		logger.WithError(waitErr).Warn("Fail to copy IO of supervised command")
+	}
+
+	result := exitResult{args: args, duration: time.Since(started)}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.signal = status.Signal()
+		result.code = 128 + int(result.signal)
+	} else {
+		result.code = cmd.ProcessState.ExitCode()
+	}
+
+	// An error of post-exit function is returned only if the command succeeded
+	// because exit status of the command takes priority.
+	var postErr error
+	for _, f := range x.postExit {
+		if err := f(result); err != nil {
+			if result.code == 0 && postErr == nil {
+				postErr = err
+				continue
+			}
+			logger.WithError(err).Warn("Fail to run post-exit action")
+		}
+	}
+
+	if result.code != 0 {
+		return &exitError{code: result.code, signal: result.signal}
+	}
+	return postErr
+}
+
+// logExitResult is post-exit function to audit exit status of the command.
+func logExitResult(result exitResult) error {
+	fields := logrus.Fields{
+		"args":     result.args,
+		"status":   result.code,
+		"duration": result.duration,
+	}
+	if result.signal != 0 {
+		fields["signal"] = result.signal
+	}
+	if result.code != 0 {
+		logger.WithFields(fields).Info("Supervised command exited with error")
+	} else {
+		logger.WithFields(fields).Debug("Supervised command exited")
+	}
+	return nil
+}
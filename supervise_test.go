@@ -0,0 +1,99 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyWriter calls onWrite once when the written data contains keyword.
+type notifyWriter struct {
+	buf     bytes.Buffer
+	keyword string
+	onWrite func()
+	once    sync.Once
+	mutex   sync.Mutex
+}
+
+func (x *notifyWriter) Write(p []byte) (int, error) {
+	x.mutex.Lock()
+	n, err := x.buf.Write(p)
+	found := strings.Contains(x.buf.String(), x.keyword)
+	x.mutex.Unlock()
+
+	if found && x.onWrite != nil {
+		x.once.Do(x.onWrite)
+	}
+	return n, err
+}
+
+func (x *notifyWriter) String() string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.buf.String()
+}
+
+func runSuperviseTest(stdout, stderr *notifyWriter, args ...string) error {
+	params := newTestParams(&bytes.Buffer{}, nil, "/some/where", "PATH=/bin:/usr/bin", "COLOR=red")
+	params.ExtIO.Stdout, params.ExtIO.Stderr = stdout, stderr
+	params.ExtIO.Exec = func(binary string, args []string, env []string) error {
+		panic("exec must not be called in supervise mode")
+	}
+
+	return NewApp(params).Run(append([]string{"altenv", "--supervise"}, args...))
+}
+
+func TestSuperviseCommand(t *testing.T) {
+	stdout, stderr := &notifyWriter{}, &notifyWriter{}
+	err := runSuperviseTest(stdout, stderr, "-d", "COLOR=blue", "/bin/sh", "-c", "echo $COLOR; echo $COLOR >&2")
+	require.NoError(t, err)
+	assert.Equal(t, "blue\n", stdout.String())
+	assert.Equal(t, "blue\n", stderr.String())
+}
+
+func TestSuperviseExitStatus(t *testing.T) {
+	err := runSuperviseTest(&notifyWriter{}, &notifyWriter{}, "/bin/sh", "-c", "exit 3")
+	require.Error(t, err)
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	assert.Equal(t, 3, code)
+}
+
+func TestSuperviseTerminatedBySignal(t *testing.T) {
+	err := runSuperviseTest(&notifyWriter{}, &notifyWriter{}, "/bin/sh", "-c", "kill -TERM $$")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Command is terminated by signal: terminated")
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	assert.Equal(t, 128+int(syscall.SIGTERM), code)
+}
+
+func TestSuperviseForwardSignal(t *testing.T) {
+	stdout := &notifyWriter{
+		keyword: "ready",
+		onWrite: func() {
+			require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+		},
+	}
+	err := runSuperviseTest(stdout, &notifyWriter{}, "/bin/sh", "-c",
+		"trap 'echo caught; exit 7' USR1; echo ready; while true; do sleep 0.1; done")
+	require.Error(t, err)
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	assert.Equal(t, 7, code)
+	assert.Equal(t, "ready\ncaught\n", stdout.String())
+}
+
+func TestSuperviseCommandNotFound(t *testing.T) {
+	err := runSuperviseTest(&notifyWriter{}, &notifyWriter{}, "no-such-command-for-altenv-test")
+	require.Error(t, err)
+	_, ok := ExitStatus(err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// parseTempFile parses `KEY=CONTENT` style entry of `file` config. Unlike
+// define, spaces and new lines of the content are kept.
+func parseTempFile(s string) (string, string, error) {
+	pos := strings.Index(s, "=")
+	if pos < 0 {
+		return "", "", fmt.Errorf("Invalid format: '%s'", s)
+	}
+	key := strings.TrimSpace(s[:pos])
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", "", fmt.Errorf("Invalid key of file: '%s'", key)
+	}
+	return key, s[pos+1:], nil
+}
+
+// tempFileKeys returns keys of `file` entries. It fails if the key is already
+// defined as variable.
+func tempFileKeys(entries []string, vars []*envvar) ([]string, error) {
+	defined := map[string]bool{}
+	for _, v := range vars {
+		defined[v.Key] = true
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		key, _, err := parseTempFile(entry)
+		if err != nil {
+			return nil, err
+		}
+		if defined[key] {
+			return nil, fmt.Errorf("`%s` of file is already defined as variable", key)
+		}
+		defined[key] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// tempFilePlaceholders returns variables of `file` entries for dryrun and plan.
+// Temp files are written only in exec mode, then the value is masked instead of
+// path of the file.
+func tempFilePlaceholders(entries []string, vars []*envvar) ([]*envvar, error) {
+	keys, err := tempFileKeys(entries, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var placeholders []*envvar
+	for _, key := range keys {
+		placeholders = append(placeholders, &envvar{Key: key, Value: maskedValue, Source: varSource{Type: "file"}, secret: true})
+	}
+	return placeholders, nil
+}
+
+// dumpTempFiles outputs keys of `file` entries with masked content as comment
+// because the temp files are not written in dryrun mode.
+func dumpTempFiles(w io.Writer, config altenvConfig, vars []*envvar, host []string) error {
+	files, err := tempFilePlaceholders(config.TempFiles, vars)
+	if err != nil {
+		return err
+	}
+	files, err = applyHostEnv(files, host, config.hostEnv)
+	if err != nil {
+		return err
+	}
+	for _, v := range files {
+		if _, err := fmt.Fprintf(w, "# %s=%s (from %s)\n", v.Key, v.Value, v.Source); err != nil {
+			return errors.Wrap(err, "Fail to output dryrun results")
+		}
+	}
+	return nil
+}
+
+// tempFiles is a private directory having temp files for a command.
+type tempFiles struct {
+	dir string
+	ext ExtIOFunc
+}
+
+// writeTempFiles renders contents of `file` entries as template with loaded
+// variables and writes them into a private temp directory. It returns
+// variables whose value is path of the written file.
+func writeTempFiles(entries []string, vars []*envvar, ext ExtIOFunc) (*tempFiles, []*envvar, error) {
+	if _, err := tempFileKeys(entries, vars); err != nil {
+		return nil, nil, err
+	}
+
+	data := map[string]string{}
+	for _, v := range vars {
+		data[v.Key] = v.Value
+	}
+
+	dir, err := ext.tempDir("", "altenv-")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Fail to create temp directory")
+	}
+	files := &tempFiles{dir: dir, ext: ext}
+
+	var newVars []*envvar
+	for _, entry := range entries {
+		key, content, _ := parseTempFile(entry)
+		rendered, err := renderTempFile(key, content, data, ext)
+		if err != nil {
+			files.cleanup()
+			return nil, nil, err
+		}
+
+		path := filepath.Join(dir, key)
+		if err := writeFile(path, rendered, ext); err != nil {
+			files.cleanup()
+			return nil, nil, errors.Wrapf(err, "Fail to write temp file of `%s`", key)
+		}
+		logger.WithFields(logrus.Fields{"key": key, "path": path}).Debug("Wrote temp file")
+
+		data[key] = path
+		newVars = append(newVars, &envvar{Key: key, Value: path, Source: varSource{Type: "file"}})
+	}
+
+	return files, newVars, nil
+}
+
+func renderTempFile(key, content string, data map[string]string, ext ExtIOFunc) ([]byte, error) {
+	if !strings.Contains(content, "{{") {
+		return []byte(content), nil
+	}
+
+	tmpl, err := template.New(key).Option("missingkey=zero").Funcs(newTemplateFuncMap(ext)).Parse(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to parse template of file `%s`", key)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, errors.Wrapf(err, "Fail to render template of file `%s`", key)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeFile(path string, data []byte, ext ExtIOFunc) error {
+	fd, err := ext.create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// cleanup removes the temp directory and files in it.
+func (x *tempFiles) cleanup() error {
+	if err := x.ext.removeAll(x.dir); err != nil {
+		return errors.Wrapf(err, "Fail to remove temp directory %s", x.dir)
+	}
+	logger.WithField("dir", x.dir).Debug("Removed temp files")
+	return nil
+}
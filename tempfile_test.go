@@ -0,0 +1,160 @@
+package main_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTempFileTestParams(config string, stdout io.Writer, dryrun *bytes.Buffer) *Parameters {
+	params := newTestParams(dryrun, map[string]string{"/conf/altenv.toml": config}, "/some/where", "PATH=/bin:/usr/bin")
+	params.ExtIO.Stdout = stdout
+	params.ExtIO.Exec = func(binary string, args []string, env []string) error {
+		panic("exec must not be called with temp files")
+	}
+	return params
+}
+
+func runTempFileTest(config string, args ...string) (string, error) {
+	stdout := &notifyWriter{}
+	params := newTempFileTestParams(config, stdout, &bytes.Buffer{})
+	err := NewApp(params).Run(append([]string{"altenv", "-c", "/conf/altenv.toml"}, args...))
+	return stdout.String(), err
+}
+
+func TestTempFile(t *testing.T) {
+	out, err := runTempFileTest(`
+[global]
+define = ["PROJECT=my-proj"]
+file = ["""GOOGLE_APPLICATION_CREDENTIALS={
+  "project_id": "{{ .PROJECT }}"
+}
+"""]
+`, "/bin/sh", "-c", `echo "$GOOGLE_APPLICATION_CREDENTIALS"; ls -ld "$(dirname "$GOOGLE_APPLICATION_CREDENTIALS")" "$GOOGLE_APPLICATION_CREDENTIALS" | cut -c1-10; cat "$GOOGLE_APPLICATION_CREDENTIALS"`)
+	require.NoError(t, err)
+
+	lines := strings.SplitN(out, "\n", 4)
+	require.Equal(t, 4, len(lines))
+	path := lines[0]
+	assert.Equal(t, "GOOGLE_APPLICATION_CREDENTIALS", filepath.Base(path))
+	assert.Equal(t, "drwx------", lines[1])
+	assert.Equal(t, "-rw-------", lines[2])
+	assert.Equal(t, "{\n  \"project_id\": \"my-proj\"\n}\n", lines[3])
+
+	_, err = os.Stat(filepath.Dir(path))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTempFileRemovedAfterFailure(t *testing.T) {
+	out, err := runTempFileTest(`
+[global]
+file = ["NPM_CONFIG_USERCONFIG=//registry.npmjs.org/:_authToken=xxx"]
+`, "/bin/sh", "-c", `echo "$NPM_CONFIG_USERCONFIG"; exit 2`)
+	require.Error(t, err)
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	assert.Equal(t, 2, code)
+
+	path := strings.TrimSpace(out)
+	require.NotEqual(t, "", path)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTempFileInvalidEntry(t *testing.T) {
+	_, err := runTempFileTest(`
+[global]
+define = ["KUBECONFIG=/tmp/config"]
+file = ["KUBECONFIG=apiVersion: v1"]
+`, "/bin/sh", "-c", "true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "`KUBECONFIG` of file is already defined as variable")
+
+	_, err = runTempFileTest(`
+[global]
+file = ["../KEY=value"]
+`, "/bin/sh", "-c", "true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid key of file: '../KEY'")
+}
+
+func TestTempFileExtIO(t *testing.T) {
+	stdout := &notifyWriter{}
+	params := newTempFileTestParams(`
+[global]
+define = ["USER=blue"]
+file = ["NETRC=login {{ .USER }}"]
+`, stdout, &bytes.Buffer{})
+
+	files := map[string]string{}
+	var removed []string
+	params.ExtIO.TempDir = func(dir, pattern string) (string, error) {
+		return "/tmp/altenv-test", nil
+	}
+	params.ExtIO.CreateFunc = testFiles(files).create
+	params.ExtIO.RemoveAll = func(path string) error {
+		removed = append(removed, path)
+		return nil
+	}
+
+	err := NewApp(params).Run([]string{"altenv", "-c", "/conf/altenv.toml", "/bin/sh", "-c", "echo $NETRC"})
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/altenv-test/NETRC\n", stdout.String())
+	assert.Equal(t, map[string]string{"/tmp/altenv-test/NETRC": "login blue"}, files)
+	assert.Equal(t, []string{"/tmp/altenv-test"}, removed)
+}
+
+func TestTempFileDryRun(t *testing.T) {
+	config := `
+[global]
+define = ["COLOR=blue"]
+file = ["NPM_CONFIG_USERCONFIG=//registry.npmjs.org/:_authToken=xxx"]
+`
+	dryrun := &bytes.Buffer{}
+	params := newTempFileTestParams(config, &notifyWriter{}, dryrun)
+	require.NoError(t, NewApp(params).Run([]string{"altenv", "-c", "/conf/altenv.toml", "-r", "dryrun"}))
+	assert.Equal(t, "COLOR=blue\n# NPM_CONFIG_USERCONFIG=******** (from file)\n", dryrun.String())
+
+	plan := &bytes.Buffer{}
+	params = newTempFileTestParams(config, &notifyWriter{}, plan)
+	require.NoError(t, NewApp(params).Run([]string{"altenv", "-c", "/conf/altenv.toml", "-r", "plan"}))
+	assert.Contains(t, plan.String(), "+ NPM_CONFIG_USERCONFIG=******** (from file)\n")
+	assert.Contains(t, plan.String(), "2 added, 0 changed, 0 shadowed, 0 denied\n")
+	assert.NotContains(t, plan.String(), "xxx")
+}
+
+func TestTempFileHostEnv(t *testing.T) {
+	run := func(policy string) (string, error) {
+		stdout := &notifyWriter{}
+		params := newTempFileTestParams(`
+[global]
+file = ["GOOGLE_APPLICATION_CREDENTIALS={}"]
+`, stdout, &bytes.Buffer{})
+		params.ExtIO.Environ = func() []string {
+			return []string{"PATH=/bin:/usr/bin", "GOOGLE_APPLICATION_CREDENTIALS=/host/cred.json"}
+		}
+		err := NewApp(params).Run([]string{"altenv", "-c", "/conf/altenv.toml", "--hostenv", policy,
+			"/bin/sh", "-c", `echo "$GOOGLE_APPLICATION_CREDENTIALS"`})
+		return stdout.String(), err
+	}
+
+	out, err := run("replace")
+	require.NoError(t, err)
+	assert.Equal(t, "GOOGLE_APPLICATION_CREDENTIALS\n", filepath.Base(out))
+
+	out, err = run("keep")
+	require.NoError(t, err)
+	assert.Equal(t, "/host/cred.json\n", out)
+
+	out, err = run("deny")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Deny to overwrite inherited environment variable `GOOGLE_APPLICATION_CREDENTIALS`")
+	assert.Equal(t, "", out)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newTemplateFuncMap(ext ExtIOFunc) template.FuncMap {
+	hostenv := splitEnviron(ext.environ())
+
+	return template.FuncMap{
+		"env": func(key string) string {
+			return hostenv[key]
+		},
+		"default": func(def, value string) string {
+			if value == "" {
+				return def
+			}
+			return value
+		},
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"b64dec": func(s string) (string, error) {
+			raw, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return "", errors.Wrap(err, "Fail to decode base64")
+			}
+			return string(raw), nil
+		},
+		"urlquery": url.QueryEscape,
+		"uuid":     newUUID,
+		"now": func(layout ...string) string {
+			if len(layout) > 0 {
+				return time.Now().Format(layout[0])
+			}
+			return time.Now().Format(time.RFC3339)
+		},
+		"hostname": ext.hostname,
+		"file": func(path string) (string, error) {
+			fd, err := ext.OpenFunc(path)
+			if err != nil {
+				return "", errors.Wrapf(err, "Fail to open %s", path)
+			}
+			defer fd.Close()
+
+			raw, err := ioutil.ReadAll(fd)
+			if err != nil {
+				return "", errors.Wrapf(err, "Fail to read %s", path)
+			}
+			return string(raw), nil
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"join": func(sep string, items ...interface{}) string {
+			var values []string
+			for _, item := range items {
+				switch v := item.(type) {
+				case []string:
+					values = append(values, v...)
+				default:
+					values = append(values, fmt.Sprint(v))
+				}
+			}
+			return strings.Join(values, sep)
+		},
+	}
+}
+
+// newUUID generates random UUID (version 4).
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", errors.Wrap(err, "Fail to generate UUID")
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// templateRefs collects variable names referred as `.KEY` in template.
+func templateRefs(node parse.Node, refs map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateRefs(child, refs)
+		}
+	case *parse.ActionNode:
+		templateRefs(n.Pipe, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateRefs(cmd, refs)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			templateRefs(arg, refs)
+		}
+	case *parse.ChainNode:
+		templateRefs(n.Node, refs)
+	case *parse.FieldNode:
+		refs[n.Ident[0]] = true
+	case *parse.IfNode:
+		templateRefs(n.Pipe, refs)
+		templateRefs(n.List, refs)
+		templateRefs(n.ElseList, refs)
+	case *parse.RangeNode:
+		templateRefs(n.Pipe, refs)
+		templateRefs(n.List, refs)
+		templateRefs(n.ElseList, refs)
+	case *parse.WithNode:
+		templateRefs(n.Pipe, refs)
+		templateRefs(n.List, refs)
+		templateRefs(n.ElseList, refs)
+	}
+}
+
+type templateRenderer struct {
+	vars   map[string]*envvar
+	tmpls  map[string]*template.Template
+	data   map[string]string
+	status map[string]int
+}
+
+const (
+	renderNotYet = iota
+	renderInProgress
+	renderDone
+)
+
+// renderTemplates renders values of vars as text/template. Other variables
+// can be referred as `.KEY` and they are rendered before the referrer.
+func renderTemplates(vars []*envvar, ext ExtIOFunc) error {
+	renderer := &templateRenderer{
+		vars:   map[string]*envvar{},
+		tmpls:  map[string]*template.Template{},
+		data:   map[string]string{},
+		status: map[string]int{},
+	}
+	funcs := newTemplateFuncMap(ext)
+
+	for _, v := range vars {
+		renderer.vars[v.Key] = v
+		renderer.data[v.Key] = v.Value
+
+		if !strings.Contains(v.Value, "{{") {
+			continue
+		}
+
+		tmpl, err := template.New(v.Key).Option("missingkey=zero").Funcs(funcs).Parse(v.Value)
+		if err != nil {
+			return errors.Wrapf(err, "Fail to parse template of `%s` (%s)", v.Key, v.Source)
+		}
+		renderer.tmpls[v.Key] = tmpl
+	}
+
+	for _, v := range vars {
+		if err := renderer.render(v.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *templateRenderer) render(key string) error {
+	tmpl, ok := x.tmpls[key]
+	if !ok || x.status[key] == renderDone {
+		return nil
+	}
+
+	v := x.vars[key]
+	if x.status[key] == renderInProgress {
+		return fmt.Errorf("Circular reference in template of `%s` (%s)", key, v.Source)
+	}
+	x.status[key] = renderInProgress
+
+	refs := map[string]bool{}
+	templateRefs(tmpl.Tree.Root, refs)
+	for ref := range refs {
+		if err := x.render(ref); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, x.data); err != nil {
+		return errors.Wrapf(err, "Fail to render template of `%s` (%s)", key, v.Source)
+	}
+
+	v.Value = buf.String()
+	x.data[key] = v.Value
+	x.status[key] = renderDone
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"sort"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+)
+
+func readTOMLFile(fpath string, opts structOptions, open fileOpen) ([]*envvar, error) {
+	fpath, query := splitPathQuery(fpath)
+
+	fd, err := open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseTOMLFile(fd, query, opts)
+}
+
+func parseTOMLFile(fd io.Reader, query string, opts structOptions) ([]*envvar, error) {
+	tree, err := toml.LoadReader(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := selectPath(tomlToOrdered(tree), query)
+	if err != nil {
+		return nil, err
+	}
+
+	envvars, err := structToEnvVars(selected, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range envvars {
+		logger.WithFields(logrus.Fields{
+			"type":  "tomlfile",
+			"key":   v.Key,
+			"value": v.Value,
+		}).Debug("Add a new variable")
+	}
+
+	return envvars, nil
+}
+
+// tomlToOrdered converts TOML tree to orderedMap based structure. Keys are
+// sorted by position in the file because toml.Tree does not keep key order.
+func tomlToOrdered(data interface{}) interface{} {
+	switch v := data.(type) {
+	case *toml.Tree:
+		keys := v.Keys()
+		sort.SliceStable(keys, func(i, j int) bool {
+			pi := v.GetPositionPath([]string{keys[i]})
+			pj := v.GetPositionPath([]string{keys[j]})
+			if pi.Line != pj.Line {
+				return pi.Line < pj.Line
+			}
+			return pi.Col < pj.Col
+		})
+
+		obj := orderedMap{}
+		for _, key := range keys {
+			obj = append(obj, orderedItem{
+				Key:   key,
+				Value: tomlToOrdered(v.GetPath([]string{key})),
+			})
+		}
+		return obj
+
+	case []*toml.Tree:
+		arr := make([]interface{}, len(v))
+		for i := range v {
+			arr[i] = tomlToOrdered(v[i])
+		}
+		return arr
+
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i := range v {
+			arr[i] = tomlToOrdered(v[i])
+		}
+		return arr
+
+	default:
+		return v
+	}
+}
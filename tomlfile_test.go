@@ -0,0 +1,46 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOMLFile(t *testing.T) {
+	data := `
+name = "proj1"
+port = 8080
+
+[database]
+host = "localhost"
+ports = [5432, 5433]
+
+[environments.dev]
+COLOR = "blue"
+`
+	configData := `
+[global]
+tomlfile = ["app.toml"]
+coerce = true
+flatten = true
+flattenSeparator = "."
+arrayFormat = "join"
+arraySeparator = ":"
+`
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, map[string]string{"testconfig": configData, "app.toml": data}, "/some/where")
+	app := NewApp(params)
+
+	err := app.Run(newArgs("-c", "testconfig", "--toml", "app.toml#.environments.dev"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "proj1", envmap["name"])
+	assert.Equal(t, "8080", envmap["port"])
+	assert.Equal(t, "localhost", envmap["database.host"])
+	assert.Equal(t, "5432:5433", envmap["database.ports"])
+	assert.Equal(t, "blue", envmap["environments.dev.COLOR"])
+	assert.Equal(t, "blue", envmap["COLOR"])
+}
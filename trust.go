@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// trustDB has content hash of project config files allowed by user.
+type trustDB struct {
+	Files map[string]string `json:"files"` // path -> SHA256 of content
+}
+
+func contentHash(raw []byte) string {
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// trustDBPath returns $XDG_DATA_HOME/altenv/trust.json (~/.local/share/altenv/trust.json).
+func trustDBPath(ext ExtIOFunc) string {
+	base := ext.getenv("XDG_DATA_HOME")
+	if base == "" {
+		base = filepath.Join(homeDir(ext), ".local", "share")
+	}
+	return filepath.Join(base, "altenv", "trust.json")
+}
+
+func loadTrustDB(ext ExtIOFunc) (*trustDB, error) {
+	db := &trustDB{Files: map[string]string{}}
+	path := trustDBPath(ext)
+
+	fd, err := ext.OpenFunc(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Fail to open trust DB: %s", path)
+	}
+	defer fd.Close()
+
+	raw, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to read trust DB: %s", path)
+	}
+	if err := json.Unmarshal(raw, db); err != nil {
+		return nil, errors.Wrapf(err, "Fail to parse trust DB: %s", path)
+	}
+	if db.Files == nil {
+		db.Files = map[string]string{}
+	}
+
+	return db, nil
+}
+
+func (x *trustDB) save(ext ExtIOFunc) error {
+	path := trustDBPath(ext)
+
+	raw, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Fail to encode trust DB")
+	}
+
+	fd, err := ext.create(path)
+	if err != nil {
+		return errors.Wrapf(err, "Fail to create trust DB: %s", path)
+	}
+	defer fd.Close()
+
+	if _, err := fd.Write(raw); err != nil {
+		return errors.Wrapf(err, "Fail to write trust DB: %s", path)
+	}
+	return nil
+}
+
+// verify checks if the project config file is allowed and not changed.
+func (x *trustDB) verify(path string, raw []byte) error {
+	hash, ok := x.Files[path]
+	if !ok {
+		return fmt.Errorf("Project config file %s is not allowed. Review it and run `altenv -r allow` to trust it", path)
+	}
+	if hash != contentHash(raw) {
+		return fmt.Errorf("Project config file %s has been changed since allowed. Review it and run `altenv -r allow` again", path)
+	}
+	return nil
+}
+
+// trustTargets loads project config files that are specified by args or
+// discovered from CWD, and their included files. Trust is not verified.
+func trustTargets(args []string, ext ExtIOFunc) ([]*configFile, error) {
+	cwd, err := ext.Getwd()
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail to get CWD")
+	}
+
+	loader := newConfigLoader(ext)
+	loader.checkTrust = false
+
+	if len(args) > 0 {
+		for _, arg := range args {
+			path := expandPath(arg, cwd, ext)
+			if found, err := loader.load(path, true); err != nil {
+				return nil, err
+			} else if !found {
+				return nil, fmt.Errorf("Config file is not found: %s", path)
+			}
+		}
+	} else {
+		for _, path := range projectConfigPaths(cwd) {
+			if _, err := loader.load(path, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return loader.files, nil
+}
+
+// allowConfigFiles records content hash of project config files to trust DB.
+func allowConfigFiles(args []string, ext ExtIOFunc) error {
+	files, err := trustTargets(args, ext)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("No project config file (%s) is found", projectConfigName)
+	}
+
+	db, err := loadTrustDB(ext)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		db.Files[file.path] = file.hash
+		logger.WithField("path", file.path).Info("Allowed project config file")
+	}
+
+	return db.save(ext)
+}
+
+// denyConfigFiles removes project config files from trust DB. Specified
+// files are removed even if they can not be loaded (e.g. broken or deleted).
+func denyConfigFiles(args []string, ext ExtIOFunc) error {
+	var paths []string
+	files, err := trustTargets(args, ext)
+	if err != nil {
+		if len(args) == 0 {
+			return errors.Wrap(err, "Fail to load project config files, specify files to revoke")
+		}
+		logger.WithError(err).Warn("Fail to load project config files, revoke only specified files")
+		cwd, err := ext.Getwd()
+		if err != nil {
+			return errors.Wrap(err, "Fail to get CWD")
+		}
+		for _, arg := range args {
+			paths = append(paths, expandPath(arg, cwd, ext))
+		}
+	}
+	for _, file := range files {
+		paths = append(paths, file.path)
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("No project config file (%s) is found to revoke", projectConfigName)
+	}
+
+	db, err := loadTrustDB(ext)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if _, ok := db.Files[path]; ok {
+			delete(db.Files, path)
+			logger.WithField("path", path).Info("Revoked project config file")
+		}
+	}
+
+	return db.save(ext)
+}
@@ -0,0 +1,88 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTrustTestParams(buf *bytes.Buffer, files map[string]string) *Parameters {
+	params := newTestParams(buf, files, "/work/proj1", "HOME=/home/blue")
+	params.ExtIO.CreateFunc = testFiles(files).create
+	return params
+}
+
+func TestTrustProjectConfig(t *testing.T) {
+	files := map[string]string{
+		"/work/proj1/.altenv.toml": `
+[global]
+define = ["COLOR=blue"]
+`,
+	}
+	const trustDBPath = "/home/blue/.local/share/altenv/trust.json"
+
+	// Not allowed yet
+	buf := &bytes.Buffer{}
+	err := NewApp(newTrustTestParams(buf, files)).Run(newArgs())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not allowed")
+
+	// Allow
+	err = NewApp(newTrustTestParams(buf, files)).Run([]string{"altenv", "-r", "allow"})
+	require.NoError(t, err)
+	assert.Contains(t, files[trustDBPath], "/work/proj1/.altenv.toml")
+
+	buf.Reset()
+	err = NewApp(newTrustTestParams(buf, files)).Run(newArgs())
+	require.NoError(t, err)
+	assert.Equal(t, "blue", toEnvVars(buf)["COLOR"])
+
+	// Changed after allowed
+	files["/work/proj1/.altenv.toml"] = `
+[global]
+define = ["LD_PRELOAD=/tmp/evil.so"]
+`
+	err = NewApp(newTrustTestParams(buf, files)).Run(newArgs())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has been changed")
+
+	// Revoke
+	err = NewApp(newTrustTestParams(buf, files)).Run([]string{"altenv", "-r", "deny"})
+	require.NoError(t, err)
+	assert.NotContains(t, files[trustDBPath], "/work/proj1/.altenv.toml")
+}
+
+func TestTrustAllowNoProjectConfig(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := NewApp(newTrustTestParams(buf, map[string]string{})).Run([]string{"altenv", "-r", "allow"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No project config file")
+}
+
+func TestTrustDenyBrokenProjectConfig(t *testing.T) {
+	const trustDBPath = "/home/blue/.local/share/altenv/trust.json"
+	files := map[string]string{
+		"/work/proj1/.altenv.toml": "[global\n",
+		trustDBPath:                `{"files":{"/work/proj1/.altenv.toml":"xxx"}}`,
+	}
+
+	buf := &bytes.Buffer{}
+	err := NewApp(newTrustTestParams(buf, files)).Run([]string{"altenv", "-r", "deny"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "specify files to revoke")
+	assert.Equal(t, `{"files":{"/work/proj1/.altenv.toml":"xxx"}}`, files[trustDBPath])
+
+	err = NewApp(newTrustTestParams(buf, files)).Run([]string{"altenv", "-r", "deny", "/work/proj1/.altenv.toml"})
+	require.NoError(t, err)
+	assert.NotContains(t, files[trustDBPath], "/work/proj1/.altenv.toml")
+}
+
+func TestTrustDenyNoProjectConfig(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := NewApp(newTrustTestParams(buf, map[string]string{})).Run([]string{"altenv", "-r", "deny"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No project config file (.altenv.toml) is found to revoke")
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var stopSignalMap = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// parseStopSignal converts signal name, e.g. `SIGTERM` or `TERM`, to signal.
+func parseStopSignal(name string) (syscall.Signal, error) {
+	sig, ok := stopSignalMap[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("Invalid stop signal: `%s`, must be [TERM|INT|HUP|QUIT|KILL|USR1|USR2]", name)
+	}
+	return sig, nil
+}
+
+// globRecorder records glob patterns expanded while resolving variables.
+type globRecorder struct {
+	ext      ExtIOFunc
+	patterns map[string]bool
+}
+
+func newGlobRecorder(ext ExtIOFunc) *globRecorder {
+	return &globRecorder{ext: ext, patterns: map[string]bool{}}
+}
+
+func (x *globRecorder) Glob(pattern string) ([]string, error) {
+	x.patterns[pattern] = true
+	return x.ext.glob(pattern)
+}
+
+func (x *globRecorder) list() []string {
+	var patterns []string
+	for pattern := range x.patterns {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// watchSources is a resolved environment and files read to resolve it.
+type watchSources struct {
+	config      *altenvConfig
+	vars        []*envvar
+	files       []string
+	patterns    []string
+	fingerprint string
+}
+
+// sourcesFingerprint returns hash of content of files and paths matched with
+// glob patterns. Then a new file matched with a pattern is also detected.
+func sourcesFingerprint(files, patterns []string, ext ExtIOFunc) string {
+	hash := sha256.New()
+	fmt.Fprintln(hash, filesFingerprint(files, ext.OpenFunc))
+	for _, pattern := range patterns {
+		digest := "-"
+		if matches, err := ext.glob(pattern); err == nil {
+			digest = strings.Join(matches, "\x00")
+		}
+		fmt.Fprintf(hash, "%s\x00%s\n", pattern, digest)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// loadWatchSources resolves variables in the same way as exec mode, and
+// records files opened and glob patterns expanded on the way. input is used for
+// --input and --prompt options instead of ExtIO.
+func loadWatchSources(params parameters, args []string, input *onceInput) (*watchSources, error) {
+	ext := input.replay(*params.ExtIO)
+	recorder, globs := newOpenRecorder(ext.OpenFunc), newGlobRecorder(ext)
+	ext.OpenFunc, ext.Glob = recorder.Open, globs.Glob
+
+	src := &watchSources{}
+	defer func() {
+		src.files, src.patterns = recorder.files(), globs.list()
+		src.fingerprint = sourcesFingerprint(src.files, src.patterns, *params.ExtIO)
+	}()
+
+	config, err := setupConfig(params, args, ext)
+	if err != nil {
+		return src, err
+	}
+	vars, err := loadEnvVars(*config, ext)
+	if err != nil {
+		return src, err
+	}
+	vars, err = applyHostEnv(vars, ext.environ(), config.hostEnv)
+	if err != nil {
+		return src, err
+	}
+
+	src.config, src.vars = config, vars
+	return src, nil
+}
+
+// changedKeys returns keys added, removed and changed from old to new.
+func changedKeys(oldVars, newVars []*envvar) ([]string, []string, []string) {
+	oldMap, newMap := map[string]string{}, map[string]string{}
+	for _, v := range oldVars {
+		oldMap[v.Key] = v.Value
+	}
+	for _, v := range newVars {
+		newMap[v.Key] = v.Value
+	}
+
+	var added, removed, changed []string
+	for key, value := range newMap {
+		old, ok := oldMap[key]
+		switch {
+		case !ok:
+			added = append(added, key)
+		case old != value:
+			changed = append(changed, key)
+		}
+	}
+	for key := range oldMap {
+		if _, ok := newMap[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// watchCommand runs the command in supervise mode and restarts it when files
+// read to resolve variables are changed. It returns when the command exits by
+// itself.
+func watchCommand(params parameters, args []string) error {
+	if params.RunMode != "exec" {
+		return fmt.Errorf("--watch is available only in exec mode")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("No arguments")
+	}
+	stopSignal, err := parseStopSignal(params.StopSignal)
+	if err != nil {
+		return err
+	}
+	if params.WatchInterval <= 0 {
+		return fmt.Errorf("--watch-interval must be positive")
+	}
+
+	binary, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	// stdin and prompt are read only once and used for every reload
+	input, err := readOnceInput(params)
+	if err != nil {
+		return err
+	}
+	current, err := loadWatchSources(params, args, input)
+	if err != nil {
+		return err
+	}
+	ext := *params.ExtIO
+	if _, err := checkNestedProfile(params.Profile, ext.environ(), current.config.nested); err != nil {
+		return err
+	}
+
+	start := func(src *watchSources) (*supervisor, <-chan error) {
+		sv := newSupervisor(ext)
+		sv.stopSignal = stopSignal
+		sv.stopTimeout = params.StopTimeout
+
+		done := make(chan error, 1)
+		go func() {
+			vars, err := runPreHooks(src.vars, *src.config, ext)
+			if err != nil {
+				done <- err
+				return
+			}
+			done <- superviseCommand(sv, vars, binary, args, *src.config, ext)
+		}()
+		return sv, done
+	}
+
+	logger.WithFields(logrus.Fields{
+		"files":    current.files,
+		"patterns": current.patterns,
+	}).Debug("Watch files")
+	sv, done := start(current)
+	ticker := time.NewTicker(params.WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+
+		case <-ticker.C:
+			if sourcesFingerprint(current.files, current.patterns, ext) == current.fingerprint {
+				continue
+			}
+
+			next, err := loadWatchSources(params, args, input)
+			if err != nil {
+				logger.WithError(err).Error("Fail to reload sources, keep running command")
+				current.files, current.patterns, current.fingerprint = next.files, next.patterns, next.fingerprint
+				continue
+			}
+
+			added, removed, changed := changedKeys(current.vars, next.vars)
+			current = next
+			if len(added)+len(removed)+len(changed) == 0 {
+				logger.Debug("Sources changed, but no variable is changed")
+				continue
+			}
+
+			logger.WithFields(logrus.Fields{
+				"added":   added,
+				"removed": removed,
+				"changed": changed,
+			}).Info("Variables changed, restart command")
+
+			sv.requestStop()
+			if err := <-done; err != nil {
+				if _, ok := exitStatus(err); !ok {
+					return errors.Wrap(err, "Fail to stop command")
+				}
+			}
+			sv, done = start(current)
+		}
+	}
+}
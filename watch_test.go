@@ -0,0 +1,124 @@
+package main_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchTestScript outputs COLOR and exits if it is blue. Otherwise it keeps
+// running until stopped. trapTerm is a trap action of SIGTERM.
+func watchTestScript(trapTerm string) string {
+	return `echo "$COLOR"; [ "$COLOR" = blue ] && exit 0; trap '` + trapTerm + `' TERM; while true; do sleep 0.05; done`
+}
+
+// newWatchTestParams returns parameters that read real files because watch
+// mode checks them by polling.
+func newWatchTestParams(dir string, stdin io.Reader, stdout io.Writer) *Parameters {
+	return &Parameters{
+		ExtIO: &ExtIOFunc{
+			DryRunOutput: &bytes.Buffer{},
+			Stdin:        stdin,
+			Stdout:       stdout,
+			Environ:      func() []string { return []string{"PATH=/bin:/usr/bin"} },
+			Getwd:        func() (string, error) { return dir, nil },
+			OpenFunc: func(fname string) (io.ReadCloser, error) {
+				return os.Open(fname)
+			},
+		},
+	}
+}
+
+func runWatchTest(t *testing.T, script string, args ...string) (string, error) {
+	return runWatchTestWithStdin(t, nil, script, args...)
+}
+
+func runWatchTestWithStdin(t *testing.T, stdin io.Reader, script string, args ...string) (string, error) {
+	dir, err := ioutil.TempDir("", "altenv-watch-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile, envFile := filepath.Join(dir, "altenv.toml"), filepath.Join(dir, "test.env")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("[global]\nenvfile = [\"test.env\"]\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(envFile, []byte("COLOR=red\n"), 0600))
+
+	stdout := &notifyWriter{
+		keyword: "red",
+		onWrite: func() {
+			require.NoError(t, ioutil.WriteFile(envFile, []byte("COLOR=blue\n"), 0600))
+		},
+	}
+	params := newWatchTestParams(dir, stdin, stdout)
+	args = append([]string{"altenv", "-c", configFile, "--watch", "--watch-interval", "20ms"}, args...)
+	err = NewApp(params).Run(append(args, "/bin/sh", "-c", script))
+	return stdout.String(), err
+}
+
+func TestWatchRestartCommand(t *testing.T) {
+	out, err := runWatchTest(t, watchTestScript("exit 0"))
+	require.NoError(t, err)
+	assert.Equal(t, "red\nblue\n", out)
+}
+
+func TestWatchReloadWithStdin(t *testing.T) {
+	script := `echo "$COLOR $SHAPE"; [ "$COLOR" = blue ] && exit 0; trap 'exit 0' TERM; while true; do sleep 0.05; done`
+	out, err := runWatchTestWithStdin(t, strings.NewReader("SHAPE=circle\n"), script, "-i", "env")
+	require.NoError(t, err)
+	assert.Equal(t, "red circle\nblue circle\n", out)
+}
+
+func TestWatchKillAfterStopTimeout(t *testing.T) {
+	started := time.Now()
+	out, err := runWatchTest(t, watchTestScript(""), "--stop-timeout", "100ms")
+	require.NoError(t, err)
+	assert.Equal(t, "red\nblue\n", out)
+	assert.True(t, time.Since(started) >= 100*time.Millisecond)
+}
+
+func TestWatchStopSignal(t *testing.T) {
+	script := `echo "$COLOR"; [ "$COLOR" = blue ] && exit 0; trap 'exit 0' USR1; while true; do sleep 0.05; done`
+	out, err := runWatchTest(t, script, "--stop-signal", "SIGUSR1", "--stop-timeout", "1m")
+	require.NoError(t, err)
+	assert.Equal(t, "red\nblue\n", out)
+
+	_, err = runWatchTest(t, script, "--stop-signal", "SIGFOO")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid stop signal: `SIGFOO`")
+}
+
+func TestWatchOnlyInExecMode(t *testing.T) {
+	_, err := runWatchTest(t, "true", "-r", "shell")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--watch is available only in exec mode")
+}
+
+func TestWatchNewFileMatchedWithGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "altenv-watch-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "altenv.toml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("[global]\nenvfile = [\"*.env\"]\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.env"), []byte("COLOR=red\n"), 0600))
+
+	stdout := &notifyWriter{
+		keyword: "red",
+		onWrite: func() {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.env"), []byte("SHADE=dark\n"), 0600))
+		},
+	}
+	params := newWatchTestParams(dir, nil, stdout)
+	script := `echo "$COLOR$SHADE"; [ -n "$SHADE" ] && exit 0; trap 'exit 0' TERM; while true; do sleep 0.05; done`
+	err = NewApp(params).Run([]string{"altenv", "-c", configFile, "--watch", "--watch-interval", "20ms", "/bin/sh", "-c", script})
+	require.NoError(t, err)
+	assert.Equal(t, "red\nreddark\n", stdout.String())
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// splitSegments splits cleaned absolute path into segments.
+func splitSegments(path string) []string {
+	path = strings.Trim(filepath.Clean(path), "/")
+	if path == "" || path == "." {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// matchPrefixSegments returns true if pattern matches leading segments of
+// path. Each pattern segment is filepath.Match style and `**` matches zero
+// or more segments.
+func matchPrefixSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPrefixSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+	if ok, err := filepath.Match(pattern[0], path[0]); err != nil || !ok {
+		return false
+	}
+	return matchPrefixSegments(pattern[1:], path[1:])
+}
+
+// matchDirPath returns true if dir is the directory of pattern or under it.
+// Matching is done on path boundary, then `/work/proj1` does not match
+// `/work/proj10`.
+func matchDirPath(pattern, dir string) bool {
+	return matchPrefixSegments(splitSegments(pattern), splitSegments(dir))
+}
+
+// workdirSpecificity returns number of literal segments and number of all
+// segments of dirpath. Larger is more specific.
+func workdirSpecificity(pattern string) (int, int) {
+	segments := splitSegments(pattern)
+	literal := 0
+	for _, seg := range segments {
+		if !hasGlobMeta(seg) && seg != "**" {
+			literal++
+		}
+	}
+	return literal, len(segments)
+}
+
+type workdirMatch struct {
+	label   string
+	dirPath string
+	order   int
+	config  altenvConfig
+}
+
+// workdirPatterns returns dirpath and its symlink resolved path.
+func workdirPatterns(dirPath string, ext ExtIOFunc) []string {
+	patterns := []string{dirPath}
+	if !hasGlobMeta(dirPath) {
+		if resolved, err := ext.evalSymlinks(dirPath); err == nil && resolved != dirPath {
+			patterns = append(patterns, resolved)
+		}
+	}
+	return patterns
+}
+
+// matchWorkdir checks if the workdir section is applied to any of cwds.
+func matchWorkdir(dir altenvConfig, cwds []string, ext ExtIOFunc) bool {
+	dirPath := expandConfigPath(dir.DirPath, "", ext)
+
+	matched := false
+	for _, pattern := range workdirPatterns(dirPath, ext) {
+		for _, cwd := range cwds {
+			if matchDirPath(pattern, cwd) {
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		return false
+	}
+
+	for _, exclude := range dir.Exclude {
+		pattern := expandConfigPath(exclude, dirPath, ext)
+		for _, cwd := range cwds {
+			if matchDirPath(pattern, cwd) {
+				logger.WithField("exclude", exclude).WithField("dirpath", dir.DirPath).Debug("Excluded workdir")
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// sortWorkdirMatches sorts matched workdir sections from least to most
+// specific. Ties are broken by label and order of config files.
+func sortWorkdirMatches(matches []workdirMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		li, ai := workdirSpecificity(matches[i].dirPath)
+		lj, aj := workdirSpecificity(matches[j].dirPath)
+		if li != lj {
+			return li < lj
+		}
+		if ai != aj {
+			return ai < aj
+		}
+		if matches[i].label != matches[j].label {
+			return matches[i].label < matches[j].label
+		}
+		return matches[i].order < matches[j].order
+	})
+}
@@ -0,0 +1,121 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runWorkdirTest(t *testing.T, configData, cwd string) map[string]string {
+	buf := &bytes.Buffer{}
+	params := newTestParams(buf, map[string]string{"testconfig": configData}, cwd, "HOME=/home/blue")
+	params.ExtIO.EvalSymlinks = func(path string) (string, error) {
+		if path == "/link/proj1" {
+			return "/work/proj1", nil
+		}
+		return path, nil
+	}
+
+	err := NewApp(params).Run(newArgs("-c", "testconfig"))
+	require.NoError(t, err)
+	return toEnvVars(buf)
+}
+
+func TestWorkdirPathBoundary(t *testing.T) {
+	configData := `
+[workdir.proj1]
+dirpath = "/work/proj1"
+define = ["PROJ1=yes"]
+
+[workdir.proj10]
+dirpath = "/work/proj10"
+define = ["PROJ10=yes"]
+`
+	envmap := runWorkdirTest(t, configData, "/work/proj10/src")
+	assert.NotContains(t, envmap, "PROJ1")
+	assert.Equal(t, "yes", envmap["PROJ10"])
+
+	envmap = runWorkdirTest(t, configData, "/work/proj1")
+	assert.Equal(t, "yes", envmap["PROJ1"])
+	assert.NotContains(t, envmap, "PROJ10")
+}
+
+func TestWorkdirGlobHomeAndSymlink(t *testing.T) {
+	configData := `
+[workdir.anysrc]
+dirpath = "/work/*/src"
+define = ["SRC=yes"]
+
+[workdir.deep]
+dirpath = "/work/**/cmd"
+define = ["CMD=yes"]
+
+[workdir.home]
+dirpath = "~/works"
+define = ["HOME_WORKS=yes"]
+
+[workdir.real]
+dirpath = "/work/proj1"
+define = ["REAL=yes"]
+`
+	envmap := runWorkdirTest(t, configData, "/work/proj2/src/pkg")
+	assert.Equal(t, "yes", envmap["SRC"])
+	assert.NotContains(t, envmap, "CMD")
+
+	envmap = runWorkdirTest(t, configData, "/work/proj2/x/y/cmd")
+	assert.Equal(t, "yes", envmap["CMD"])
+	assert.NotContains(t, envmap, "SRC")
+
+	envmap = runWorkdirTest(t, configData, "/home/blue/works/proj")
+	assert.Equal(t, "yes", envmap["HOME_WORKS"])
+
+	envmap = runWorkdirTest(t, configData, "/link/proj1")
+	assert.Equal(t, "yes", envmap["REAL"])
+}
+
+func TestWorkdirExclude(t *testing.T) {
+	configData := `
+[workdir.proj1]
+dirpath = "/work/proj1"
+exclude = ["vendor", "/work/proj1/**/node_modules"]
+define = ["PROJ1=yes"]
+`
+	envmap := runWorkdirTest(t, configData, "/work/proj1/src")
+	assert.Equal(t, "yes", envmap["PROJ1"])
+
+	envmap = runWorkdirTest(t, configData, "/work/proj1/vendor/lib")
+	assert.NotContains(t, envmap, "PROJ1")
+
+	envmap = runWorkdirTest(t, configData, "/work/proj1/web/node_modules")
+	assert.NotContains(t, envmap, "PROJ1")
+}
+
+func TestWorkdirMergeBySpecificity(t *testing.T) {
+	configData := `
+[global]
+overwrite = "allow"
+
+[workdir.a_src]
+dirpath = "/work/proj1/src"
+define = ["LEVEL=src"]
+
+[workdir.b_glob]
+dirpath = "/work/*/src"
+define = ["LEVEL=glob"]
+
+[workdir.c_proj]
+dirpath = "/work/proj1"
+define = ["LEVEL=proj"]
+
+[workdir.d_root]
+dirpath = "/"
+define = ["LEVEL=root"]
+`
+	for i := 0; i < 20; i++ {
+		envmap := runWorkdirTest(t, configData, "/work/proj1/src")
+		require.Equal(t, "src", envmap["LEVEL"])
+	}
+}
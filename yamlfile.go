@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func readYAMLFile(fpath string, opts structOptions, open fileOpen) ([]*envvar, error) {
+	fpath, query := splitPathQuery(fpath)
+
+	fd, err := open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseYAMLFile(fd, query, opts)
+}
+
+func parseYAMLFile(fd io.Reader, query string, opts structOptions) ([]*envvar, error) {
+	raw, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail to read YAML data")
+	}
+
+	var ydata yaml.MapSlice
+	if err := yaml.Unmarshal(raw, &ydata); err != nil {
+		return nil, err
+	}
+
+	selected, err := selectPath(yamlToOrdered(ydata), query)
+	if err != nil {
+		return nil, err
+	}
+
+	envvars, err := structToEnvVars(selected, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range envvars {
+		logger.WithFields(logrus.Fields{
+			"type":  "yamlfile",
+			"key":   v.Key,
+			"value": v.Value,
+		}).Debug("Add a new variable")
+	}
+
+	return envvars, nil
+}
+
+// yamlToOrdered converts decoded YAML data to orderedMap based structure.
+func yamlToOrdered(data interface{}) interface{} {
+	switch v := data.(type) {
+	case yaml.MapSlice:
+		obj := orderedMap{}
+		for _, item := range v {
+			obj = append(obj, orderedItem{
+				Key:   fmt.Sprint(item.Key),
+				Value: yamlToOrdered(item.Value),
+			})
+		}
+		return obj
+
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i := range v {
+			arr[i] = yamlToOrdered(v[i])
+		}
+		return arr
+
+	default:
+		return v
+	}
+}
@@ -0,0 +1,58 @@
+package main_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/m-mizutani/altenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newYAMLTestParams(buf *bytes.Buffer) *Parameters {
+	data := `
+image:
+  repository: nginx
+  tag: 1.19
+replicas: 3
+env:
+  dev:
+    COLOR: blue
+    HOSTS: [a, b]
+`
+	return newTestParams(buf, map[string]string{"values.yaml": data}, "/some/where")
+}
+
+func TestYAMLFileFlatten(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newYAMLTestParams(buf))
+
+	err := app.Run(newArgs("--yaml", "values.yaml", "--coerce", "--flatten", "--array-format", "join"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "nginx", envmap["image_repository"])
+	assert.Equal(t, "1.19", envmap["image_tag"])
+	assert.Equal(t, "3", envmap["replicas"])
+	assert.Equal(t, "blue", envmap["env_dev_COLOR"])
+	assert.Equal(t, "a,b", envmap["env_dev_HOSTS"])
+}
+
+func TestYAMLFileSubtree(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newYAMLTestParams(buf))
+
+	err := app.Run(newArgs("-y", "values.yaml#.env.dev", "--array-format", "json"))
+	require.NoError(t, err)
+	envmap := toEnvVars(buf)
+	assert.Equal(t, "blue", envmap["COLOR"])
+	assert.Equal(t, `["a","b"]`, envmap["HOSTS"])
+	assert.NotContains(t, envmap, "replicas")
+}
+
+func TestYAMLFileNotFound(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(newYAMLTestParams(buf))
+
+	err := app.Run(newArgs("-y", "no-such.yaml"))
+	require.Error(t, err)
+}